@@ -10,6 +10,10 @@ func AllChecks() []Check {
 		service_worker_registration_rejection(),
 		post_first_byte_by_byte_streaming(),
 		multipart_form_data(),
+		h2_rst_stream(),
+		alt_svc(),
+		keep_alive_and_pipelining(),
+		slow_headers_isolation(),
 
 		// long checks
 		simultaneous_request(),
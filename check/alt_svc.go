@@ -0,0 +1,213 @@
+package check
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/nwtgck/piping-server-check/oneshot"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func alt_svc() Check {
+	return Check{
+		Name:          getCheckName(),
+		Description:   "Alt-Svc advertises h3 and a transfer works over the advertised HTTP/3 endpoint",
+		SubCheckNames: []string{SubCheckNameTransferred, SubCheckNameProtocol},
+		// Alt-Svc for HTTP/3 is advertised over TCP with TLS
+		Protocols: []Protocol{ProtocolHttp1_1_tls, ProtocolH2},
+		Tags:      []string{TagConnection},
+		timeout: func(config *Config) time.Duration {
+			return 2*config.FixedLengthBodyGetTimeout + checkTimeoutMargin
+		},
+		run: func(config *Config, reporter RunCheckReporter) {
+			defer reporter.Close()
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
+			if !ok {
+				return
+			}
+			defer stopServerIfNeed()
+
+			path := "/" + uuid.NewString()
+			getResp, postResp, ok := transferForAltSvc("", config, serverUrl+path, reporter)
+			if !ok {
+				return
+			}
+			altSvc := getResp.Header.Get("Alt-Svc")
+			if altSvc == "" {
+				altSvc = postResp.Header.Get("Alt-Svc")
+			}
+			// A server without HTTP/3 does not need to advertise anything
+			if altSvc == "" {
+				reporter.Report(NewRunCheckResultSkipped("Alt-Svc is not advertised"))
+				return
+			}
+			h3Authority, found := findAltSvcAuthority(altSvc, "h3")
+			if !found {
+				reporter.Report(RunCheckResult{Warnings: []ResultWarning{NewWarning(fmt.Sprintf("h3 is not advertised in Alt-Svc: '%s'", altSvc), nil)}})
+				return
+			}
+			reporter.Report(RunCheckResult{Message: fmt.Sprintf("Alt-Svc: %s", altSvc)})
+
+			h3ServerUrl, err := altSvcServerUrl(serverUrl, h3Authority)
+			if err != nil {
+				reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred, Errors: []ResultError{NewError(fmt.Sprintf("invalid alt-authority '%s'", h3Authority), err)}})
+				return
+			}
+			h3Config := *config
+			h3Config.Protocol = ProtocolH3
+			if _, _, ok := transferForAltSvc(SubCheckNameTransferred, &h3Config, h3ServerUrl+"/"+uuid.NewString(), reporter); !ok {
+				return
+			}
+			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred, Message: fmt.Sprintf("transferred over %s via %s", ProtocolH3, h3ServerUrl)})
+			return
+		},
+	}
+}
+
+// findAltSvcAuthority finds alt-authority of the protocol ID in Alt-Svc header value (RFC 7838)
+func findAltSvcAuthority(altSvc string, protocolId string) (string, bool) {
+	// Commas and semicolons in quoted strings do not separate values (e.g. h3=":443"; ma=86400, h3-29=":443")
+	for _, altValue := range splitOutsideQuotes(altSvc, ',') {
+		// Parameters such as "ma=2592000" follow the alternative
+		alternative := strings.TrimSpace(splitOutsideQuotes(altValue, ';')[0])
+		id, authority, found := strings.Cut(alternative, "=")
+		if !found {
+			// "clear" or malformed
+			continue
+		}
+		// protocol-id is percent-encoded
+		if unescapedId, err := url.PathUnescape(strings.TrimSpace(id)); err != nil || unescapedId != protocolId {
+			continue
+		}
+		authority, ok := unquoteAltSvcString(strings.TrimSpace(authority))
+		if !ok {
+			continue
+		}
+		return authority, true
+	}
+	return "", false
+}
+
+// splitOutsideQuotes splits s by sep which is not in quoted-string
+func splitOutsideQuotes(s string, sep byte) []string {
+	var splits []string
+	start := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			// quoted-pair
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			splits = append(splits, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(splits, s[start:])
+}
+
+// unquoteAltSvcString unquotes quoted-string of alt-authority
+func unquoteAltSvcString(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' {
+			i++
+			if i == len(s)-1 {
+				return "", false
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), true
+}
+
+func altSvcServerUrl(serverUrl string, altAuthority string) (string, error) {
+	parsedUrl, err := url.Parse(serverUrl)
+	if err != nil {
+		return "", err
+	}
+	host, port, err := net.SplitHostPort(altAuthority)
+	if err != nil {
+		return "", err
+	}
+	// Empty host means the same host
+	if host == "" {
+		host = parsedUrl.Hostname()
+	}
+	parsedUrl.Host = net.JoinHostPort(host, port)
+	return parsedUrl.String(), nil
+}
+
+func transferForAltSvc(subcheckName string /* empty string OK */, config *Config, url string, reporter RunCheckReporter) (getResp *http.Response, postResp *http.Response, ok bool) {
+	getHttpClient := NewCheckHTTPClient(config)
+	defer getHttpClient.CloseIdleConnections()
+	postHttpClient := NewCheckHTTPClient(config)
+	defer postHttpClient.CloseIdleConnections()
+
+	bodyString := "my message"
+
+	getRespOneshot := oneshot.NewOneshot[*http.Response]()
+	go func() {
+		defer getRespOneshot.Done()
+		getReq, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("failed to create GET request", err)}})
+			return
+		}
+		getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+		if !getOk {
+			return
+		}
+		getRespOneshot.Send(getResp)
+	}()
+
+	postRespOneshot := oneshot.NewOneshot[*http.Response]()
+	go func() {
+		defer postRespOneshot.Done()
+		postReq, err := http.NewRequest("POST", url, strings.NewReader(bodyString))
+		if err != nil {
+			reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("failed to create POST request", err)}})
+			return
+		}
+		postResp, postOk := SendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
+		if !postOk {
+			return
+		}
+		postRespOneshot.Send(postResp)
+	}()
+
+	getResp, ok = respWithTimeout(subcheckName, "GET", getRespOneshot, config.FixedLengthBodyGetTimeout, reporter)
+	if !ok {
+		return
+	}
+	bodyBytes, err := io.ReadAll(getResp.Body)
+	if err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("failed to read up", err)}})
+		return nil, nil, false
+	}
+	if ok := checkCloseReceiverRespBody(getResp, reporter); !ok {
+		return nil, nil, false
+	}
+	if string(bodyBytes) != bodyString {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("message different", nil)}})
+		return nil, nil, false
+	}
+	// TODO: POST-timeout (already GET)
+	postResp, ok = <-postRespOneshot.Channel()
+	if !ok {
+		return
+	}
+	if ok := checkSenderRespReadUp(subcheckName, postResp, reporter); !ok {
+		return nil, nil, false
+	}
+	return getResp, postResp, true
+}
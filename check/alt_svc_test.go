@@ -0,0 +1,62 @@
+package check
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFindAltSvcAuthority(t *testing.T) {
+	for _, tc := range []struct {
+		altSvc        string
+		expected      string
+		expectedFound bool
+	}{
+		{altSvc: `h3=":443"`, expected: ":443", expectedFound: true},
+		{altSvc: `h3=":443"; ma=86400, h3-29=":443"`, expected: ":443", expectedFound: true},
+		{altSvc: `h3-29=":8443"; ma=86400, h3=":443"; ma=86400`, expected: ":443", expectedFound: true},
+		{altSvc: `h2="alt.example.com:443", h3="alt.example.com:8443"`, expected: "alt.example.com:8443", expectedFound: true},
+		// Separators in quoted strings
+		{altSvc: `h2="a,b;c:443"; ma=60, h3=":443"`, expected: ":443", expectedFound: true},
+		{altSvc: `h3=":443"; persist=1; foo="a,b", h2=":443"`, expected: ":443", expectedFound: true},
+		{altSvc: `h3 = ":443" ; ma=60`, expected: ":443", expectedFound: true},
+		// Percent-encoded protocol-id
+		{altSvc: `h%33=":443"`, expected: ":443", expectedFound: true},
+		// quoted-pair
+		{altSvc: `h3="\[::1\]:443"`, expected: "[::1]:443", expectedFound: true},
+		{altSvc: `h3-29=":443"`, expectedFound: false},
+		{altSvc: `h2=":443"; h3=":443"`, expectedFound: false},
+		{altSvc: `clear`, expectedFound: false},
+		{altSvc: ``, expectedFound: false},
+		// alt-authority should be a quoted-string
+		{altSvc: `h3=:443`, expectedFound: false},
+		{altSvc: `h3=":443`, expectedFound: false},
+	} {
+		authority, found := findAltSvcAuthority(tc.altSvc, "h3")
+		assert.Equal(t, tc.expectedFound, found, tc.altSvc)
+		assert.Equal(t, tc.expected, authority, tc.altSvc)
+	}
+}
+
+func TestAltSvcServerUrl(t *testing.T) {
+	for _, tc := range []struct {
+		serverUrl     string
+		altAuthority  string
+		expected      string
+		expectedError bool
+	}{
+		{serverUrl: "https://example.com", altAuthority: ":443", expected: "https://example.com:443"},
+		{serverUrl: "https://example.com:8443/prefix", altAuthority: ":443", expected: "https://example.com:443/prefix"},
+		{serverUrl: "https://example.com", altAuthority: "alt.example.com:8443", expected: "https://alt.example.com:8443"},
+		{serverUrl: "https://[::1]:8443", altAuthority: ":443", expected: "https://[::1]:443"},
+		{serverUrl: "https://example.com", altAuthority: "[::1]:443", expected: "https://[::1]:443"},
+		{serverUrl: "https://example.com", altAuthority: "443", expectedError: true},
+	} {
+		serverUrl, err := altSvcServerUrl(tc.serverUrl, tc.altAuthority)
+		if tc.expectedError {
+			assert.Error(t, err, tc.altAuthority)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, serverUrl)
+	}
+}
@@ -0,0 +1,169 @@
+package check
+
+// runCheckAttempts runs the check config.Repeat times and at most config.RetryFailed more times until an attempt passes.
+// Results of the attempts are aggregated, and a failed result is flaky if another attempt of the check passes.
+// Flakiness is decided per attempt of the check because a failed attempt can report different result names (e.g. a server start failure).
+// A flaky result is sent as soon as it is decided, and the others are sent after the last attempt.
+func runCheckAttempts(c *Check, config *Config, resultCh chan<- Result) {
+	if config.Repeat <= 1 && config.RetryFailed <= 0 {
+		runCheck(c, config, resultCh)
+		return
+	}
+	nRepeats := max(config.Repeat, 1)
+	aggregator := newAttemptAggregator()
+	lastAttemptFailed := false
+	for i := 0; i < nRepeats+config.RetryFailed; i++ {
+		if i >= nRepeats && !lastAttemptFailed {
+			break
+		}
+		ch := make(chan Result)
+		go func() {
+			runCheck(c, config, ch)
+			close(ch)
+		}()
+		var results []Result
+		for result := range ch {
+			results = append(results, result)
+			for _, decided := range aggregator.add(result) {
+				resultCh <- decided
+			}
+		}
+		for _, decided := range aggregator.endAttempt() {
+			resultCh <- decided
+		}
+		lastAttemptFailed = attemptFailed(results)
+		if attemptSkipped(results) {
+			// No need to repeat because the protocol is not supported, for example
+			break
+		}
+	}
+	for _, result := range aggregator.finish() {
+		resultCh <- result
+	}
+}
+
+func attemptFailed(results []Result) bool {
+	for _, result := range results {
+		if result.Status == ResultStatusError {
+			return true
+		}
+	}
+	return false
+}
+
+func attemptSkipped(results []Result) bool {
+	for _, result := range results {
+		if result.Status != ResultStatusSkipped {
+			return false
+		}
+	}
+	return true
+}
+
+// The same name can appear multiple times in an attempt (e.g. partial_transfer)
+type attemptResultKey struct {
+	name string
+	nth  int
+}
+
+type attemptAggregation struct {
+	last       Result
+	lastFailed *Result
+	sent       bool
+}
+
+// attemptAggregator aggregates results of attempts of a check in order of arrival
+type attemptAggregator struct {
+	// finished attempts
+	checkAttempts ResultAttempts
+	keys          []attemptResultKey
+	aggregations  map[attemptResultKey]*attemptAggregation
+	// the current attempt
+	nths           map[string]int
+	currentFailed  bool
+	currentSkipped bool
+}
+
+func newAttemptAggregator() *attemptAggregator {
+	return &attemptAggregator{aggregations: make(map[attemptResultKey]*attemptAggregation), nths: make(map[string]int), currentSkipped: true}
+}
+
+// add returns results decided by the result of the current attempt
+func (g *attemptAggregator) add(result Result) []Result {
+	key := attemptResultKey{name: result.Name, nth: g.nths[result.Name]}
+	g.nths[result.Name]++
+	a, ok := g.aggregations[key]
+	if !ok {
+		a = &attemptAggregation{}
+		g.aggregations[key] = a
+		g.keys = append(g.keys, key)
+	}
+	a.last = result
+	if result.Status != ResultStatusSkipped {
+		g.currentSkipped = false
+	}
+	if result.Status == ResultStatusError {
+		g.currentFailed = true
+		failed := result
+		a.lastFailed = &failed
+		// Flaky because an earlier attempt passed
+		if g.checkAttempts.Passed != 0 && !a.sent {
+			return []Result{g.aggregate(a)}
+		}
+	}
+	return nil
+}
+
+// endAttempt returns results decided by the end of the current attempt
+func (g *attemptAggregator) endAttempt() []Result {
+	passed := !g.currentFailed && !g.currentSkipped
+	if g.currentFailed {
+		g.checkAttempts.Failed++
+	} else if passed {
+		g.checkAttempts.Passed++
+	}
+	g.nths = make(map[string]int)
+	g.currentFailed = false
+	g.currentSkipped = true
+	if !passed {
+		return nil
+	}
+	// Failed results in earlier attempts are flaky now
+	var decided []Result
+	for _, key := range g.keys {
+		if a := g.aggregations[key]; a.lastFailed != nil && !a.sent {
+			decided = append(decided, g.aggregate(a))
+		}
+	}
+	return decided
+}
+
+// finish returns results not sent yet
+func (g *attemptAggregator) finish() []Result {
+	var rest []Result
+	for _, key := range g.keys {
+		if a := g.aggregations[key]; !a.sent {
+			rest = append(rest, g.aggregate(a))
+		}
+	}
+	return rest
+}
+
+// aggregate marks the aggregation sent. Attempts of a result sent early are the attempts until it is decided.
+func (g *attemptAggregator) aggregate(a *attemptAggregation) Result {
+	a.sent = true
+	resultAttempts := g.checkAttempts
+	if g.currentFailed {
+		resultAttempts.Failed++
+	}
+	result := a.last
+	if a.lastFailed != nil {
+		// Errors are more informative than passes
+		result = *a.lastFailed
+		if resultAttempts.Passed != 0 {
+			result.Status = ResultStatusFlaky
+		}
+	}
+	result.Attempts = &resultAttempts
+	return result
+}
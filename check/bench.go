@@ -0,0 +1,227 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BenchWorkload is transfers which RunBench repeats
+type BenchWorkload struct {
+	BodySize int64 `json:"body_size"`
+	// the number of simultaneous transfers
+	Concurrency int           `json:"concurrency"`
+	Duration    time.Duration `json:"-"`
+	// chunked (no Content-Length) if true, fixed-length otherwise
+	Chunked bool `json:"chunked"`
+}
+
+// benchWorkloadJson has no MarshalJSON or UnmarshalJSON, so they do not recurse
+type benchWorkloadJson struct {
+	benchWorkloadFields
+	Duration string `json:"duration"`
+}
+
+type benchWorkloadFields BenchWorkload
+
+func (w BenchWorkload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(benchWorkloadJson{benchWorkloadFields: benchWorkloadFields(w), Duration: w.Duration.String()})
+}
+
+func (w *BenchWorkload) UnmarshalJSON(data []byte) error {
+	var j benchWorkloadJson
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(j.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration of workload: %w", err)
+	}
+	*w = BenchWorkload(j.benchWorkloadFields)
+	w.Duration = duration
+	return nil
+}
+
+type BenchLatency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+type BenchResult struct {
+	Server      string        `json:"server,omitempty"`
+	Protocol    Protocol      `json:"protocol"`
+	Workload    BenchWorkload `json:"workload"`
+	ServerRunId string        `json:"server_run_id,omitempty"`
+	// successful and failed transfers
+	Transfers int     `json:"transfers"`
+	Failures  int     `json:"failures"`
+	ErrorRate float64 `json:"error_rate"`
+	// from the start of the sender's request to the end of the receiver's body of successful transfers
+	LatencyMs BenchLatency `json:"latency_ms"`
+	// body bytes of successful transfers per second of the whole bench
+	BytesPerSec float64 `json:"bytes_per_sec"`
+	ElapsedMs   float64 `json:"elapsed_ms"`
+	// an error of the server start-up or the first errors of transfers
+	Errors []ResultError `json:"errors,omitempty"`
+}
+
+const maxBenchResultErrors = 10
+
+// RunBench repeats transfers of the workload on config.Protocol for workload.Duration.
+// Transfers in flight at the end are given config.GetResponseReceivedTimeout to finish.
+func RunBench(config *Config, workload BenchWorkload) BenchResult {
+	result := BenchResult{Server: config.ServerName, Protocol: config.Protocol, Workload: workload}
+	if workload.Chunked && (config.Protocol == ProtocolHttp1_0 || config.Protocol == ProtocolHttp1_0_tls) {
+		result.Errors = []ResultError{NewError("HTTP/1.0 does not support chunked encoding", nil)}
+		return result
+	}
+
+	runCheckResultCh := make(chan RunCheckResult)
+	reporter := NewRunCheckReporter(runCheckResultCh)
+	reportedCh := make(chan []ResultError)
+	go func() {
+		var resultErrors []ResultError
+		for runCheckResult := range runCheckResultCh {
+			resultErrors = append(resultErrors, runCheckResult.Errors...)
+		}
+		reportedCh <- resultErrors
+	}()
+	serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
+	result.ServerRunId = reporter.serverRunId
+	reporter.Close()
+	resultErrors := <-reportedCh
+	if !ok {
+		result.Errors = resultErrors
+		return result
+	}
+	defer stopServerIfNeed()
+
+	body := make([]byte, workload.BodySize)
+	for i := range body {
+		body[i] = byte(i % 251)
+	}
+	startTime := time.Now()
+	ctx, cancel := context.WithDeadline(context.Background(), startTime.Add(workload.Duration+config.GetResponseReceivedTimeout))
+	defer cancel()
+	var mu sync.Mutex
+	var latencies []time.Duration
+	var wg sync.WaitGroup
+	for i := 0; i < workload.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sendHttpClient := NewHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			defer sendHttpClient.CloseIdleConnections()
+			getHttpClient := NewHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			defer getHttpClient.CloseIdleConnections()
+			for time.Since(startTime) < workload.Duration {
+				latency, err := benchTransfer(ctx, config.Protocol, sendHttpClient, getHttpClient, serverUrl+"/"+uuid.NewString(), body, workload.Chunked)
+				mu.Lock()
+				result.Transfers++
+				if err != nil {
+					result.Failures++
+					if len(result.Errors) < maxBenchResultErrors {
+						result.Errors = append(result.Errors, NewError("transfer failed", err))
+					}
+				} else {
+					latencies = append(latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(startTime)
+
+	result.ElapsedMs = durationMs(elapsed)
+	if result.Transfers != 0 {
+		result.ErrorRate = float64(result.Failures) / float64(result.Transfers)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result.LatencyMs = BenchLatency{
+		P50: durationMs(percentile(latencies, 50)),
+		P90: durationMs(percentile(latencies, 90)),
+		P99: durationMs(percentile(latencies, 99)),
+	}
+	result.BytesPerSec = float64(int64(len(latencies))*workload.BodySize) / elapsed.Seconds()
+	return result
+}
+
+// percentile uses the nearest-rank method. sorted should be sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+func benchTransfer(ctx context.Context, protocol Protocol, sendHttpClient *http.Client, getHttpClient *http.Client, url string, body []byte, chunked bool) (time.Duration, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	startTime := time.Now()
+	sendErrCh := make(chan error, 1)
+	go func() {
+		var bodyReader io.Reader = bytes.NewReader(body)
+		if chunked {
+			// The unknown length makes the request chunked
+			bodyReader = io.MultiReader(bodyReader)
+		}
+		sendReq, err := http.NewRequestWithContext(ctx, "POST", url, bodyReader)
+		if err != nil {
+			sendErrCh <- fmt.Errorf("failed to create POST request: %w", err)
+			return
+		}
+		sendResp, err := sendHttpClient.Do(sendReq)
+		if err != nil {
+			sendErrCh <- fmt.Errorf("failed to POST: %w", err)
+			return
+		}
+		defer sendResp.Body.Close()
+		if sendResp.StatusCode != 200 {
+			sendErrCh <- fmt.Errorf("expected status=200 but status=%d found in POST", sendResp.StatusCode)
+			return
+		}
+		if _, err := io.Copy(io.Discard, sendResp.Body); err != nil {
+			sendErrCh <- fmt.Errorf("failed to read sender response body: %w", err)
+			return
+		}
+		sendErrCh <- nil
+	}()
+
+	getReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create GET request: %w", err)
+	}
+	getResp, err := getHttpClient.Do(getReq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to GET: %w", err)
+	}
+	defer getResp.Body.Close()
+	if getResp.StatusCode != 200 {
+		return 0, fmt.Errorf("expected status=200 but status=%d found in GET", getResp.StatusCode)
+	}
+	if resultErrors := CheckProtocol(getResp, protocol); len(resultErrors) != 0 {
+		return 0, fmt.Errorf("%s", resultErrors[0].Message)
+	}
+	n, err := io.Copy(io.Discard, getResp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read receiver response body: %w", err)
+	}
+	if n != int64(len(body)) {
+		return 0, fmt.Errorf("expected %d bytes but %d bytes received", len(body), n)
+	}
+	latency := time.Since(startTime)
+	if err := <-sendErrCh; err != nil {
+		return 0, err
+	}
+	return latency, nil
+}
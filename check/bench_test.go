@@ -0,0 +1,96 @@
+package check
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newMiniPipingHandler transfers a POST body to a GET of the same path regardless of the order
+func newMiniPipingHandler() http.Handler {
+	var mu sync.Mutex
+	receivers := make(map[string]chan http.ResponseWriter)
+	receiverCh := func(path string) chan http.ResponseWriter {
+		mu.Lock()
+		defer mu.Unlock()
+		ch, ok := receivers[path]
+		if !ok {
+			ch = make(chan http.ResponseWriter)
+			receivers[path] = ch
+		}
+		return ch
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			done := make(chan struct{})
+			select {
+			case receiverCh(r.URL.Path) <- &doneResponseWriter{ResponseWriter: w, done: done}:
+				<-done
+			case <-r.Context().Done():
+			}
+		case "POST":
+			select {
+			case receiver := <-receiverCh(r.URL.Path):
+				io.Copy(receiver, r.Body)
+				close(receiver.(*doneResponseWriter).done)
+			case <-r.Context().Done():
+			}
+		}
+	})
+}
+
+type doneResponseWriter struct {
+	http.ResponseWriter
+	done chan struct{}
+}
+
+func TestRunBench(t *testing.T) {
+	server := httptest.NewServer(newMiniPipingHandler())
+	defer server.Close()
+	config := Config{Protocol: ProtocolHttp1_1, ServerSchemalessUrl: strings.TrimPrefix(server.URL, "http:"), GetResponseReceivedTimeout: 5 * time.Second}
+	for _, chunked := range []bool{false, true} {
+		workload := BenchWorkload{BodySize: 64 * 1024, Concurrency: 2, Duration: 200 * time.Millisecond, Chunked: chunked}
+		result := RunBench(&config, workload)
+		assert.Empty(t, result.Errors)
+		assert.Greater(t, result.Transfers, 0)
+		assert.Equal(t, 0, result.Failures)
+		assert.Greater(t, result.LatencyMs.P50, float64(0))
+		assert.LessOrEqual(t, result.LatencyMs.P50, result.LatencyMs.P99)
+		assert.Greater(t, result.BytesPerSec, float64(0))
+	}
+}
+
+func TestRunBenchChunkedInHttp1_0(t *testing.T) {
+	config := Config{Protocol: ProtocolHttp1_0, ServerSchemalessUrl: "//localhost:1"}
+	result := RunBench(&config, BenchWorkload{BodySize: 1, Concurrency: 1, Duration: time.Second, Chunked: true})
+	assert.Equal(t, 0, result.Transfers)
+	assert.Equal(t, "HTTP/1.0 does not support chunked encoding", result.Errors[0].Message)
+}
+
+func TestBenchWorkloadJson(t *testing.T) {
+	workload := BenchWorkload{BodySize: 1024, Concurrency: 4, Duration: 10 * time.Second, Chunked: true}
+	jsonBytes, err := json.Marshal(workload)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"body_size": 1024, "concurrency": 4, "duration": "10s", "chunked": true}`, string(jsonBytes))
+	var parsed BenchWorkload
+	assert.NoError(t, json.Unmarshal(jsonBytes, &parsed))
+	assert.Equal(t, workload, parsed)
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	assert.Equal(t, time.Duration(5), percentile(sorted, 50))
+	assert.Equal(t, time.Duration(9), percentile(sorted, 90))
+	assert.Equal(t, time.Duration(10), percentile(sorted, 99))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
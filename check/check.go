@@ -3,18 +3,22 @@ package check
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/itchyny/timefmt-go"
+	"github.com/nwtgck/piping-server-check/h2c_upgrade_round_tripper"
 	"github.com/nwtgck/piping-server-check/http10_round_tripper"
 	"github.com/nwtgck/piping-server-check/util"
 	"github.com/quic-go/quic-go/http3"
 	"go.uber.org/atomic"
+	"golang.org/x/exp/slices"
 	"golang.org/x/net/http2"
 	"io"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -32,28 +36,87 @@ const (
 	ProtocolHttp1_1_tls = Protocol("http1.1-tls")
 	ProtocolH2          = Protocol("h2")
 	ProtocolH2c         = Protocol("h2c")
+	ProtocolH2cUpgrade  = Protocol("h2c-upgrade")
 	ProtocolH3          = Protocol("h3")
 )
 
+func AllProtocols() []Protocol {
+	return []Protocol{
+		ProtocolHttp1_0,
+		ProtocolHttp1_0_tls,
+		ProtocolHttp1_1,
+		ProtocolHttp1_1_tls,
+		ProtocolH2,
+		ProtocolH2c,
+		ProtocolH2cUpgrade,
+		ProtocolH3,
+	}
+}
+
+func protocolsExcept(excludedProtocols ...Protocol) []Protocol {
+	var protocols []Protocol
+	for _, protocol := range AllProtocols() {
+		if !slices.Contains(excludedProtocols, protocol) {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols
+}
+
 type Config struct {
-	RunServerCmd                                     []string
-	HealthCheckPath                                  string
-	ServerSchemalessUrl                              string
-	Protocol                                         Protocol
-	TlsSkipVerifyCert                                bool
-	Concurrency                                      uint
-	SenderResponseBeforeReceiverTimeout              time.Duration
-	FirstByteCheckTimeout                            time.Duration
-	GetResponseReceivedTimeout                       time.Duration
-	GetReqWroteRequestWaitForH3                      time.Duration // because httptrace not supported: https://github.com/quic-go/quic-go/issues/3342
-	TransferBytePerSec                               int
-	SortedTransferSpans                              []time.Duration
-	WaitDurationAfterSenderCancel                    time.Duration
-	WaitDurationBetweenReceiverWroteRequestAndCancel time.Duration
-	WaitDurationAfterReceiverCancel                  time.Duration
-	FixedLengthBodyGetTimeout                        time.Duration
-	ServiceWorkerRejectionTimeout                    time.Duration
-	NSimultaneousRequests                            int
+	RunServerCmd                                     []string        `yaml:"run_server_cmd"`
+	HealthCheckPath                                  string          `yaml:"health_check_path"`
+	ReservedPath                                     string          `yaml:"reserved_path"`
+	ServerSchemalessUrl                              string          `yaml:"server_schemaless_url"`
+	Protocol                                         Protocol        `yaml:"-"`
+	TlsSkipVerifyCert                                bool            `yaml:"tls_skip_verify_cert"`
+	Concurrency                                      uint            `yaml:"concurrency"`
+	SenderResponseBeforeReceiverTimeout              time.Duration   `yaml:"sender_response_before_receiver_timeout"`
+	FirstByteCheckTimeout                            time.Duration   `yaml:"first_byte_check_timeout"`
+	GetResponseReceivedTimeout                       time.Duration   `yaml:"get_response_received_timeout"`
+	GetReqWroteRequestWaitForH3                      time.Duration   `yaml:"get_req_wrote_request_wait_for_h3"` // because httptrace not supported: https://github.com/quic-go/quic-go/issues/3342
+	TransferBytePerSec                               int             `yaml:"transfer_byte_per_sec"`
+	SortedTransferSpans                              []time.Duration `yaml:"sorted_transfer_spans"`
+	WaitDurationAfterSenderCancel                    time.Duration   `yaml:"wait_duration_after_sender_cancel"`
+	WaitDurationBetweenReceiverWroteRequestAndCancel time.Duration   `yaml:"wait_duration_between_receiver_wrote_request_and_cancel"`
+	WaitDurationAfterReceiverCancel                  time.Duration   `yaml:"wait_duration_after_receiver_cancel"`
+	FixedLengthBodyGetTimeout                        time.Duration   `yaml:"fixed_length_body_get_timeout"`
+	ServiceWorkerRejectionTimeout                    time.Duration   `yaml:"service_worker_rejection_timeout"`
+	NSimultaneousRequests                            int             `yaml:"n_simultaneous_requests"`
+	// 0 means no timeout
+	ReadinessTimeout time.Duration `yaml:"readiness_timeout"`
+	// empty string means ReadinessStrategyHealthCheck
+	ReadinessStrategy string `yaml:"readiness_strategy"`
+	// for ReadinessStrategyLog
+	ReadinessLogRegex string `yaml:"readiness_log_regex"`
+	// for ReadinessStrategyHealthCheck. Empty string means GET.
+	HealthCheckMethod string `yaml:"health_check_method"`
+	// for ReadinessStrategyHealthCheck. 0 means 2xx.
+	HealthCheckExpectedStatus int `yaml:"health_check_expected_status"`
+	// directory of stdout and stderr logs of servers. Empty string means no logs.
+	ServerLogDir string `yaml:"server_log_dir"`
+	// the number of attempts of each check. 0 means 1.
+	Repeat int `yaml:"repeat"`
+	// the number of additional attempts of a check which has errors
+	RetryFailed int `yaml:"retry_failed"`
+	// expected maximum duration of an external check excluding server start-up
+	ExternalCheckTimeout time.Duration `yaml:"external_check_timeout"`
+	// interval of sampling resource usage of servers. 0 means no sampling.
+	ServerResourceSampleInterval   time.Duration           `yaml:"server_resource_sample_interval"`
+	ServerResourceWarningThreshold ServerResourceThreshold `yaml:"server_resource_warning_threshold"`
+	ServerResourceErrorThreshold   ServerResourceThreshold `yaml:"server_resource_error_threshold"`
+	// empty string means ServerLifecyclePerCheck
+	ServerLifecycle string `yaml:"server_lifecycle"`
+	// name of the server when checking multiple servers. Empty string means the only server.
+	ServerName string `yaml:"-"`
+	// directory to write HAR files of checks. Empty string means no HAR.
+	HarDir string `yaml:"har_dir"`
+	// bodies in HAR files are truncated to this size
+	HarMaxBodySize int64 `yaml:"har_max_body_size"`
+	// set by RunCheckTargets if HarDir is not empty
+	har *harRecorder
+	// set by RunCheckTargets for shared server lifecycles
+	sharedServers *sharedServerPool
 }
 
 func protocolUsesTls(protocol Protocol) bool {
@@ -65,7 +128,8 @@ func protocolUsesTls(protocol Protocol) bool {
 	}
 }
 
-func newHTTPClient(protocol Protocol, tlsSkipVerifyCert bool) *http.Client {
+// NewHTTPClient returns a client which speaks the protocol
+func NewHTTPClient(protocol Protocol, tlsSkipVerifyCert bool) *http.Client {
 	tlsConfig := &tls.Config{InsecureSkipVerify: tlsSkipVerifyCert}
 	// TODO: impl
 	switch protocol {
@@ -92,6 +156,10 @@ func newHTTPClient(protocol Protocol, tlsSkipVerifyCert bool) *http.Client {
 				},
 			},
 		}
+	case ProtocolH2cUpgrade:
+		return &http.Client{
+			Transport: &h2c_upgrade_round_tripper.H2cUpgradeRoundTripper{},
+		}
 	case ProtocolH2:
 		return &http.Client{
 			Transport: &http2.Transport{
@@ -108,6 +176,15 @@ func newHTTPClient(protocol Protocol, tlsSkipVerifyCert bool) *http.Client {
 	return nil
 }
 
+// NewCheckHTTPClient returns NewHTTPClient for the check. Exchanges are recorded in the HAR of the check if config.HarDir is set.
+func NewCheckHTTPClient(config *Config) *http.Client {
+	client := NewHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+	if config.har != nil {
+		client.Transport = &harRoundTripper{base: client.Transport, recorder: config.har}
+	}
+	return client
+}
+
 type ResultError struct {
 	Message string `json:"message"`
 }
@@ -134,15 +211,89 @@ func NewWarning(message string, err error) ResultWarning {
 	return ResultWarning{Message: fmt.Sprintf("%s: %+v", message, err)}
 }
 
+type ResultStatus string
+
+const (
+	ResultStatusOk      = ResultStatus("ok")
+	ResultStatusError   = ResultStatus("error")
+	ResultStatusWarning = ResultStatus("warning")
+	ResultStatusSkipped = ResultStatus("skipped")
+	// failed in some attempts of the check while other attempts of the check passed
+	ResultStatusFlaky = ResultStatus("flaky")
+)
+
 type Result struct {
 	// result name can be "<check name>.<subcheck name>" or "<check name>"
 	Name        string          `json:"name"`
 	Protocol    Protocol        `json:"protocol"`
+	Server      string          `json:"server,omitempty"`
+	Status      ResultStatus    `json:"status"`
+	SkipReason  string          `json:"skip_reason,omitempty"`
 	Message     string          `json:"message,omitempty"`
 	OkForJson   *bool           `json:"ok,omitempty"`
 	Errors      []ResultError   `json:"errors,omitempty"`
 	Warnings    []ResultWarning `json:"warnings,omitempty"`
 	ServerRunId string          `json:"server_run_id,omitempty"`
+	// time for the server to become ready
+	ServerReadyMs float64 `json:"server_ready_ms,omitempty"`
+	// --server-log-dir only
+	ServerStdoutLogPath string `json:"server_stdout_log_path,omitempty"`
+	ServerStderrLogPath string `json:"server_stderr_log_path,omitempty"`
+	// failed results of servers run by --server-command only
+	ServerLogTail *ServerLogTail `json:"server_log_tail,omitempty"`
+	// usage of the server until the result
+	ServerResources *ServerResources `json:"server_resources,omitempty"`
+	// start time of the check
+	StartedAt time.Time `json:"started_at"`
+	// from the start of the check to the result
+	Duration   time.Duration `json:"-"`
+	DurationMs float64       `json:"duration_ms"`
+	// for transfer subchecks
+	Transfer *TransferTiming `json:"transfer,omitempty"`
+	// nil if the check is attempted once
+	Attempts *ResultAttempts `json:"attempts,omitempty"`
+	// --har-dir only
+	HarPath string `json:"har_path,omitempty"`
+}
+
+// ResultAttempts is the numbers of passed and failed attempts of the check
+type ResultAttempts struct {
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+}
+
+// setServerRun should be called before the status is determined because resource usage can add errors and warnings
+func (r *Result) setServerRun(config *Config, run *serverRun /* nil OK */) {
+	if run == nil {
+		return
+	}
+	if run.resourceWindow != nil {
+		r.ServerResources = run.resourceWindow.resources()
+		if r.ServerResources != nil {
+			addServerResourceProblems(config, r.ServerResources, r)
+		}
+	}
+	if run.readyDuration != 0 {
+		r.ServerReadyMs = durationMs(run.readyDuration)
+	}
+	// empty if no --server-log-dir
+	r.ServerStdoutLogPath = run.logs.stdoutPath
+	r.ServerStderrLogPath = run.logs.stderrPath
+	// The tail is kept in memory regardless of --server-log-dir
+	if len(r.Errors) != 0 {
+		r.ServerLogTail = run.logs.tail()
+	}
+}
+
+func (r *Result) setTiming(startTime time.Time) {
+	r.StartedAt = startTime
+	r.Duration = time.Since(startTime)
+	r.DurationMs = durationMs(r.Duration)
+}
+
+// durationMs is for JSON
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
 }
 
 // Subcheck name is top-level. The same subcheck names in different checks should be the same meaning.
@@ -157,34 +308,176 @@ const (
 	SubCheckNameTransferred                  = "transferred"
 	SubCheckNameReusePath                    = "reuse_path"
 	SubCheckNamePartialTransfer              = "partial_transfer"
+	SubCheckNameSenderTermination            = "sender_termination"
+	SubCheckNameConnectionReuse              = "connection_reuse"
+	SubCheckNameKeepAlive                    = "keep_alive"
+	SubCheckNamePipelining                   = "pipelining"
 )
 
+// Tags are for selecting checks
+const (
+	TagBasic      = "basic"
+	TagCancel     = "cancel"
+	TagStreaming  = "streaming"
+	TagConnection = "connection"
+	TagSecurity   = "security"
+	// long check takes time depending on options such as --transfer-span.
+	// It is a tag rather than a field so that --tag and --exclude-tag select it like other groups.
+	TagLong = "long"
+	// check run by an executable, whose subcheck names are not known in advance
+	TagExternal = "external"
+)
+
+func AllTags() []string {
+	return []string{TagBasic, TagCancel, TagStreaming, TagConnection, TagSecurity, TagLong, TagExternal}
+}
+
+// RunCheckResult is also the JSON line format of external checks
 type RunCheckResult struct {
 	// empty string is ok
-	SubCheckName string
-	Message      string
-	Errors       []ResultError
-	Warnings     []ResultWarning
-	ServerRunId  string
+	SubCheckName string          `json:"subcheck_name"`
+	Message      string          `json:"message"`
+	Errors       []ResultError   `json:"errors"`
+	Warnings     []ResultWarning `json:"warnings"`
+	// not empty when the check or subcheck is skipped
+	SkipReason  string `json:"skip_reason"`
+	ServerRunId string `json:"-"`
+	// for transfer subchecks
+	Transfer *TransferTiming `json:"transfer"`
 }
 
 func NewRunCheckResultWithOneError(resultError ResultError) RunCheckResult {
 	return RunCheckResult{Errors: []ResultError{resultError}}
 }
 
+func NewRunCheckResultSkipped(skipReason string) RunCheckResult {
+	return RunCheckResult{SkipReason: skipReason}
+}
+
+func resultStatus(result *Result) ResultStatus {
+	if result.SkipReason != "" {
+		return ResultStatusSkipped
+	}
+	if len(result.Errors) != 0 {
+		return ResultStatusError
+	}
+	if len(result.Warnings) != 0 {
+		return ResultStatusWarning
+	}
+	return ResultStatusOk
+}
+
 type Check struct {
-	Name string
-	run  func(config *Config, reporter RunCheckReporter)
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// subcheck names which the check can emit
+	SubCheckNames []string   `json:"subcheck_names"`
+	Protocols     []Protocol `json:"protocols"`
+	Tags          []string   `json:"tags"`
+	// expected maximum duration of run
+	timeout func(config *Config) time.Duration
+	run     func(config *Config, reporter RunCheckReporter)
+}
+
+// NewCheck builds a custom check from the exported fields of c and run.
+// run should call reporter.Close() when it finishes like built-in checks.
+// The check times out in defaultCustomCheckTimeout unless WithTimeout is used.
+func NewCheck(c Check, run func(config *Config, reporter RunCheckReporter)) Check {
+	c.run = run
+	c.timeout = defaultCustomCheckTimeout
+	return c
+}
+
+// defaultCustomCheckTimeout allows a custom check to do a few fixed-length transfers
+func defaultCustomCheckTimeout(config *Config) time.Duration {
+	return 2*config.FixedLengthBodyGetTimeout + checkTimeoutMargin
+}
+
+// WithTimeout returns a copy of the check which times out in the duration returned by timeout.
+func (c Check) WithTimeout(timeout func(config *Config) time.Duration) Check {
+	c.timeout = timeout
+	return c
 }
 
+// Time for overheads in a check. Starting a server is not included because the check timeout is paused while starting it.
+const checkTimeoutMargin = 10 * time.Second
+
 type RunCheckReporter struct {
 	ch          chan<- RunCheckResult
 	closed      *atomic.Bool
 	serverRunId string
+	ctx         context.Context
+	servers     *reporterServers
+	// nil if no timeout
+	timer *checkTimer
+}
+
+// checkTimer calls a function when the check has run for the timeout, not counting paused time.
+type checkTimer struct {
+	mu        sync.Mutex
+	f         func()
+	remaining time.Duration
+	startedAt time.Time
+	timer     *time.Timer
+	// number of pause() without resume()
+	pauses int
+}
+
+func newCheckTimer(timeout time.Duration, f func()) *checkTimer {
+	return &checkTimer{f: f, remaining: timeout, startedAt: time.Now(), timer: time.AfterFunc(timeout, f)}
+}
+
+func (t *checkTimer) pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pauses++
+	if t.pauses == 1 && t.timer.Stop() {
+		t.remaining -= time.Since(t.startedAt)
+	}
+}
+
+func (t *checkTimer) resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pauses--
+	if t.pauses == 0 {
+		t.startedAt = time.Now()
+		t.timer = time.AfterFunc(t.remaining, t.f)
+	}
+}
+
+func (t *checkTimer) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Prevent resume() from starting the timer again
+	t.pauses++
+	t.timer.Stop()
+}
+
+// reporterServers holds servers started in a check to kill them when the check times out
+type reporterServers struct {
+	mu              sync.Mutex
+	killServers     []func()
+	lastServerRunId string
+	// key: server run ID
+	runs map[string]*serverRun
+	// shared servers used in the check, which should not be killed
+	sharedServers []*sharedServer
+}
+
+type serverRun struct {
+	logs          *serverLogs
+	readyDuration time.Duration
+	// nil if not sampled
+	resourceWindow *serverResourceWindow
 }
 
 func NewRunCheckReporter(ch chan<- RunCheckResult) RunCheckReporter {
-	return RunCheckReporter{ch: ch, closed: atomic.NewBool(false)}
+	return newRunCheckReporterWithContext(context.Background(), ch)
+}
+
+func newRunCheckReporterWithContext(ctx context.Context, ch chan<- RunCheckResult) RunCheckReporter {
+	return RunCheckReporter{ch: ch, closed: atomic.NewBool(false), ctx: ctx, servers: &reporterServers{runs: make(map[string]*serverRun)}}
 }
 
 func (r *RunCheckReporter) SetServerRunId(serverRunId string /* empty string is OK */) {
@@ -196,7 +489,10 @@ func (r *RunCheckReporter) Report(result RunCheckResult) {
 		return
 	}
 	result.ServerRunId = r.serverRunId
-	r.ch <- result
+	select {
+	case r.ch <- result:
+	case <-r.ctx.Done():
+	}
 }
 
 func (r *RunCheckReporter) Close() {
@@ -204,6 +500,91 @@ func (r *RunCheckReporter) Close() {
 	close(r.ch)
 }
 
+func (r *RunCheckReporter) addServer(serverRunId string, killServer func() /* nil OK */, logs *serverLogs, resourceWindow *serverResourceWindow /* nil OK */) {
+	r.servers.mu.Lock()
+	defer r.servers.mu.Unlock()
+	if killServer != nil {
+		r.servers.killServers = append(r.servers.killServers, killServer)
+	}
+	r.servers.lastServerRunId = serverRunId
+	r.servers.runs[serverRunId] = &serverRun{logs: logs, resourceWindow: resourceWindow}
+}
+
+func (r *RunCheckReporter) setServerReadyDuration(serverRunId string, readyDuration time.Duration) {
+	r.servers.mu.Lock()
+	defer r.servers.mu.Unlock()
+	r.servers.runs[serverRunId].readyDuration = readyDuration
+}
+
+func (r *RunCheckReporter) addSharedServer(s *sharedServer) {
+	r.servers.mu.Lock()
+	added := slices.Contains(r.servers.sharedServers, s)
+	if added {
+		r.servers.lastServerRunId = s.server.id
+	} else {
+		r.servers.sharedServers = append(r.servers.sharedServers, s)
+	}
+	r.servers.mu.Unlock()
+	// A check can prepare the server multiple times (e.g. simultaneous_request)
+	if added {
+		return
+	}
+	var resourceWindow *serverResourceWindow
+	if s.server.resourceMonitor != nil {
+		// Usage before the check is charged to earlier checks
+		resourceWindow = s.server.resourceMonitor.newWindow()
+	}
+	r.addServer(s.server.id, nil, s.server.logs, resourceWindow)
+	r.setServerReadyDuration(s.server.id, s.readyDuration)
+}
+
+// closeSharedServerResourceWindows should be called after the results of the check
+func (r *RunCheckReporter) closeSharedServerResourceWindows() {
+	r.servers.mu.Lock()
+	defer r.servers.mu.Unlock()
+	for _, s := range r.servers.sharedServers {
+		if resourceWindow := r.servers.runs[s.server.id].resourceWindow; resourceWindow != nil {
+			resourceWindow.close()
+		}
+	}
+}
+
+// sharedServerCrashErrors returns errors of shared servers which exited after the check started at checkStartTime
+func (r *RunCheckReporter) sharedServerCrashErrors(checkStartTime time.Time) (serverRunIds []string, resultErrors []ResultError) {
+	r.servers.mu.Lock()
+	defer r.servers.mu.Unlock()
+	for _, s := range r.servers.sharedServers {
+		if resultError := s.crashError(checkStartTime); resultError != nil {
+			serverRunIds = append(serverRunIds, s.server.id)
+			resultErrors = append(resultErrors, *resultError)
+		}
+	}
+	return
+}
+
+// serverRun returns a copy or nil if not found
+func (r *RunCheckReporter) serverRun(serverRunId string) *serverRun {
+	r.servers.mu.Lock()
+	defer r.servers.mu.Unlock()
+	run, ok := r.servers.runs[serverRunId]
+	if !ok {
+		return nil
+	}
+	runCopy := *run
+	return &runCopy
+}
+
+// abort stops reporting and kills servers started in the check
+func (r *RunCheckReporter) abort() (lastServerRunId string) {
+	r.closed.Store(true)
+	r.servers.mu.Lock()
+	defer r.servers.mu.Unlock()
+	for _, killServer := range r.servers.killServers {
+		killServer()
+	}
+	return r.servers.lastServerRunId
+}
+
 func getCheckName() string {
 	counter, _, _, success := runtime.Caller(1)
 	if !success {
@@ -214,33 +595,16 @@ func getCheckName() string {
 	return functionName[index+1:]
 }
 
-func startServer(cmd []string, httpPort string, httpsPort string, runServerId string) (c *exec.Cmd, stdout io.ReadCloser, stderr io.ReadCloser, err error) {
+func startServer(cmd []string, httpPort string, httpsPort string, runServerId string, stdout io.Writer, stderr io.Writer) (c *exec.Cmd, err error) {
 	c = exec.Command(cmd[0], cmd[1:]...)
 	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	c.Env = append(os.Environ(), "HTTP_PORT="+httpPort, "HTTPS_PORT="+httpsPort, "SERVER_RUN_ID="+runServerId)
-	stdout, err = c.StdoutPipe()
-	if err != nil {
-		return
-	}
-	stderr, err = c.StderrPipe()
-	if err != nil {
-		return
-	}
+	c.Stdout = stdout
+	c.Stderr = stderr
 	err = c.Start()
 	return
 }
 
-func waitHTTPServer(httpClient *http.Client, healthCheckUrl string) {
-	time.Sleep(100 * time.Millisecond)
-	for {
-		resp, err := httpClient.Get(healthCheckUrl)
-		if err == nil && (200 <= resp.StatusCode && resp.StatusCode < 300) {
-			return
-		}
-		time.Sleep(200 * time.Millisecond)
-	}
-}
-
 var currentServerRunIdInt = 1
 var currentServerRunIdMutex sync.Mutex
 
@@ -254,7 +618,22 @@ func generateServerRunId() string {
 
 var portPool = util.NewPortPool()
 
-func prepareServer(config *Config, serverRunId string) (serverUrl string, stopSerer func(), resultErrors []ResultError) {
+// startedServer is a server process run by Config.RunServerCmd
+type startedServer struct {
+	id              string
+	httpPort        string
+	httpsPort       string
+	logs            *serverLogs
+	resourceMonitor *serverResourceMonitor
+	signal          func(sig syscall.Signal)
+	logMatched      <-chan struct{}
+	// closed when the server exits
+	exited   chan struct{}
+	exitErr  error
+	exitedAt time.Time
+}
+
+func startServerRun(config *Config, serverRunId string) (server *startedServer, resultErrors []ResultError) {
 	httpPort, err := portPool.GetAndReserve()
 	if err != nil {
 		resultErrors = append(resultErrors, FailedToGetPortError())
@@ -262,75 +641,182 @@ func prepareServer(config *Config, serverRunId string) (serverUrl string, stopSe
 	}
 	httpsPort, err := portPool.GetAndReserve()
 	if err != nil {
+		portPool.Release(httpPort)
 		resultErrors = append(resultErrors, FailedToGetPortError())
 		return
 	}
+	releasePorts := func() {
+		portPool.Release(httpPort)
+		portPool.Release(httpsPort)
+	}
 
-	cmd, _, stderr, err := startServer(config.RunServerCmd, httpPort, httpsPort, serverRunId)
+	logs, err := newServerLogs(config.ServerLogDir, serverRunId)
 	if err != nil {
+		releasePorts()
+		resultErrors = append(resultErrors, NewError("failed to create server logs", err))
+		return
+	}
+	stdout, stderr := logs.stdout, logs.stderr
+	var logMatched <-chan struct{}
+	if config.ReadinessStrategy == ReadinessStrategyLog {
+		regex, err := regexp.Compile(config.ReadinessLogRegex)
+		if err != nil {
+			logs.close()
+			releasePorts()
+			resultErrors = append(resultErrors, NewError("invalid readiness log regex", err))
+			return
+		}
+		matcher := newLogLineMatcher(regex)
+		stdout = io.MultiWriter(stdout, matcher.writer())
+		stderr = io.MultiWriter(stderr, matcher.writer())
+		logMatched = matcher.matched
+	}
+	cmd, err := startServer(config.RunServerCmd, httpPort, httpsPort, serverRunId, stdout, stderr)
+	if err != nil {
+		logs.close()
+		releasePorts()
 		resultErrors = append(resultErrors, ResultError{Message: fmt.Sprintf("failed to run server: %+v", err)})
 		return
 	}
-
-	finishCh := make(chan struct{})
+	server = &startedServer{id: serverRunId, httpPort: httpPort, httpsPort: httpsPort, logs: logs, logMatched: logMatched, exited: make(chan struct{})}
+	if interval := serverResourceSampleInterval(config); interval != 0 {
+		server.resourceMonitor = startServerResourceMonitor(cmd.Process.Pid, interval)
+	}
 	go func() {
-		stderrStringCh := make(chan string)
-		go func() {
-			var buf [2048]byte
-			// err can be ignored because empty bytes will be an empty string
-			n, _ := io.ReadFull(stderr, buf[:])
-			stderrString := string(buf[:n])
-			stderrStringCh <- stderrString
-		}()
-		err := cmd.Wait()
-		stderrString := <-stderrStringCh
-		if err != nil {
-			resultErrors = append(resultErrors, NewError(fmt.Sprintf("%+v, stderr: %s", err, stderrString), err))
+		server.exitErr = cmd.Wait()
+		server.exitedAt = time.Now()
+		if server.resourceMonitor != nil {
+			server.resourceMonitor.stop()
 		}
-		finishCh <- struct{}{}
+		logs.close()
+		// The ports are released even if the server exited unexpectedly
+		releasePorts()
+		close(server.exited)
 	}()
 
-	stopSerer = func() {
-		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM); err != nil {
-			fmt.Fprintf(os.Stderr, "failed to stop server %s: %+v\n", serverRunId, err)
-			return
-		}
-		portPool.Release(httpPort)
-		portPool.Release(httpsPort)
+	var stopOnce sync.Once
+	server.signal = func(sig syscall.Signal) {
+		stopOnce.Do(func() {
+			if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to stop server %s: %+v\n", serverRunId, err)
+			}
+		})
 	}
-	serverPort := httpPort
-	if protocolUsesTls(config.Protocol) {
-		serverPort = httpsPort
+	return
+}
+
+func (s *startedServer) port(protocol Protocol) string {
+	if protocolUsesTls(protocol) {
+		return s.httpsPort
 	}
-	httpAddress := net.JoinHostPort("localhost", serverPort)
-	if protocolUsesTls(config.Protocol) {
-		serverUrl = "https://" + httpAddress
-	} else {
-		serverUrl = "http://" + httpAddress
+	return s.httpPort
+}
+
+func (s *startedServer) url(protocol Protocol) string {
+	httpAddress := net.JoinHostPort("localhost", s.port(protocol))
+	if protocolUsesTls(protocol) {
+		return "https://" + httpAddress
 	}
+	return "http://" + httpAddress
+}
 
+// waitReady kills the server if it is not ready
+func (s *startedServer) waitReady(config *Config) (readyDuration time.Duration, resultErrors []ResultError) {
+	readyCtx := context.Background()
+	if config.ReadinessTimeout != 0 {
+		var cancel context.CancelFunc
+		readyCtx, cancel = context.WithTimeout(readyCtx, config.ReadinessTimeout)
+		defer cancel()
+	}
+	readyCtx, cancelReady := context.WithCancel(readyCtx)
+	defer cancelReady()
+	readyStartTime := time.Now()
+	readyCh := make(chan error, 1)
 	go func() {
-		client := newHTTPClient(config.Protocol, true /* always skip verification for health check */)
-		defer client.CloseIdleConnections()
-		waitHTTPServer(client, serverUrl+config.HealthCheckPath)
-		finishCh <- struct{}{}
+		readyCh <- waitServerReady(readyCtx, config, s.url(config.Protocol), s.port(config.Protocol), s.logMatched)
 	}()
 
-	<-finishCh
+	select {
+	case <-s.exited:
+		if s.exitErr != nil {
+			resultErrors = append(resultErrors, NewError(fmt.Sprintf("%+v, stderr: %s", s.exitErr, s.logs.stderrTail.String()), s.exitErr))
+		} else {
+			resultErrors = append(resultErrors, NewError(fmt.Sprintf("server exited before ready, stderr: %s", s.logs.stderrTail.String()), nil))
+		}
+	case err := <-readyCh:
+		if err == nil {
+			readyDuration = time.Since(readyStartTime)
+			if s.resourceMonitor != nil {
+				// A short check may finish before the next sample
+				s.resourceMonitor.sample()
+			}
+			break
+		}
+		s.signal(syscall.SIGKILL)
+		if errors.Is(err, context.DeadlineExceeded) {
+			strategy := config.ReadinessStrategy
+			if strategy == "" {
+				strategy = ReadinessStrategyHealthCheck
+			}
+			resultErrors = append(resultErrors, NewError(fmt.Sprintf("server not ready in %s (readiness strategy: %s), stderr: %s", config.ReadinessTimeout, strategy, s.logs.stderrTail.String()), nil))
+		} else {
+			resultErrors = append(resultErrors, NewError("failed to wait for server ready", err))
+		}
+	}
 	return
 }
 
-func prepareServerUrl(config *Config, reporter *RunCheckReporter) (serverUrl string, ok bool, stopServerIfNeed func()) {
+func prepareServer(config *Config, serverRunId string, reporter *RunCheckReporter) (serverUrl string, stopSerer func(), resultErrors []ResultError) {
+	server, resultErrors := startServerRun(config, serverRunId)
+	if len(resultErrors) != 0 {
+		return
+	}
+	stopSerer = func() { server.signal(syscall.SIGTERM) }
+	var resourceWindow *serverResourceWindow
+	if server.resourceMonitor != nil {
+		resourceWindow = server.resourceMonitor.lifetime
+	}
+	// The server should be killed even while waiting for it when the check times out
+	reporter.addServer(serverRunId, func() { server.signal(syscall.SIGKILL) }, server.logs, resourceWindow)
+	readyDuration, resultErrors := server.waitReady(config)
+	if len(resultErrors) != 0 {
+		return
+	}
+	reporter.setServerReadyDuration(serverRunId, readyDuration)
+	return server.url(config.Protocol), stopSerer, nil
+}
+
+// PrepareServerUrl starts a server by config.RunServerCmd or uses config.ServerSchemalessUrl.
+// If not ok, an error has been reported. stopServerIfNeed should be called when the check finishes.
+func PrepareServerUrl(config *Config, reporter *RunCheckReporter) (serverUrl string, ok bool, stopServerIfNeed func()) {
+	// Server start-up is limited by config.ReadinessTimeout, not by the check timeout
+	if reporter.timer != nil {
+		reporter.timer.pause()
+		defer reporter.timer.resume()
+	}
+	if config.ServerSchemalessUrl == "" && config.sharedServers != nil {
+		s := config.sharedServers.get(config)
+		if len(s.resultErrors) != 0 {
+			if s.server != nil {
+				reporter.SetServerRunId(s.server.id)
+			}
+			reporter.Report(RunCheckResult{Errors: s.resultErrors})
+			return
+		}
+		reporter.addSharedServer(s)
+		reporter.SetServerRunId(s.server.id)
+		return s.server.url(config.Protocol), true, func() {}
+	}
 	if config.ServerSchemalessUrl == "" {
 		var stopServer func()
 		var resultErrors []ResultError
 		serverRunId := generateServerRunId()
-		serverUrl, stopServer, resultErrors = prepareServer(config, serverRunId)
+		serverUrl, stopServer, resultErrors = prepareServer(config, serverRunId, reporter)
+		reporter.SetServerRunId(serverRunId)
 		if len(resultErrors) != 0 {
 			reporter.Report(RunCheckResult{Errors: resultErrors})
 			return
 		}
-		reporter.SetServerRunId(serverRunId)
 		return serverUrl, true, stopServer
 	}
 	if protocolUsesTls(config.Protocol) {
@@ -349,11 +835,75 @@ func ensureContentLengthExits(req *http.Request) {
 }
 
 func runCheck(c *Check, config *Config, resultCh chan<- Result) {
+	startTime := time.Now()
+	if len(c.Protocols) != 0 && !slices.Contains(c.Protocols, config.Protocol) {
+		result := Result{
+			Name:       c.Name,
+			Protocol:   config.Protocol,
+			Status:     ResultStatusSkipped,
+			SkipReason: fmt.Sprintf("%s is not supported", config.Protocol),
+		}
+		result.setTiming(startTime)
+		resultCh <- result
+		return
+	}
+	var harPath string
+	if config.har != nil {
+		harPath = config.har.path
+	}
 	runCheckResultCh := make(chan RunCheckResult)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reporter := newRunCheckReporterWithContext(ctx, runCheckResultCh)
+	defer reporter.closeSharedServerResourceWindows()
+	var timeout time.Duration
+	if c.timeout != nil {
+		timeout = c.timeout(config)
+		// The timer is paused while PrepareServerUrl starts a server
+		reporter.timer = newCheckTimer(timeout, cancel)
+		defer reporter.timer.stop()
+	}
 	go func() {
-		c.run(config, NewRunCheckReporter(runCheckResultCh))
+		c.run(config, reporter)
 	}()
-	for runCheckResult := range runCheckResultCh {
+	for {
+		var runCheckResult RunCheckResult
+		select {
+		case r, ok := <-runCheckResultCh:
+			if !ok {
+				// A shared server crash is charged to the check running on it
+				serverRunIds, resultErrors := reporter.sharedServerCrashErrors(startTime)
+				for i, resultError := range resultErrors {
+					result := Result{
+						Name:        c.Name,
+						Protocol:    config.Protocol,
+						Errors:      []ResultError{resultError},
+						ServerRunId: serverRunIds[i],
+						HarPath:     harPath,
+					}
+					result.setTiming(startTime)
+					result.setServerRun(config, reporter.serverRun(serverRunIds[i]))
+					result.Status = resultStatus(&result)
+					resultCh <- result
+				}
+				return
+			}
+			runCheckResult = r
+		case <-ctx.Done():
+			serverRunId := reporter.abort()
+			result := Result{
+				Name:        c.Name,
+				Protocol:    config.Protocol,
+				Status:      ResultStatusError,
+				Errors:      []ResultError{NewError(fmt.Sprintf("check timed out in %s", timeout), nil)},
+				ServerRunId: serverRunId,
+				HarPath:     harPath,
+			}
+			result.setTiming(startTime)
+			result.setServerRun(config, reporter.serverRun(serverRunId))
+			resultCh <- result
+			return
+		}
 		var result Result
 		if runCheckResult.SubCheckName == "" {
 			result.Name = c.Name
@@ -363,9 +913,15 @@ func runCheck(c *Check, config *Config, resultCh chan<- Result) {
 		result.Message = runCheckResult.Message
 		result.Errors = runCheckResult.Errors
 		result.Warnings = runCheckResult.Warnings
+		result.SkipReason = runCheckResult.SkipReason
+		result.Transfer = runCheckResult.Transfer
 		result.ServerRunId = runCheckResult.ServerRunId
 		result.Protocol = config.Protocol
-		if len(result.Errors) == 0 {
+		result.HarPath = harPath
+		result.setServerRun(config, reporter.serverRun(result.ServerRunId))
+		result.Status = resultStatus(&result)
+		result.setTiming(startTime)
+		if result.Status != ResultStatusError && result.Status != ResultStatusSkipped {
 			result.OkForJson = new(bool)
 			*result.OkForJson = true
 		}
@@ -373,36 +929,68 @@ func runCheck(c *Check, config *Config, resultCh chan<- Result) {
 	}
 }
 
+// CheckTarget is a check to run in the protocol
+type CheckTarget struct {
+	Check    Check
+	Protocol Protocol
+}
+
 func RunChecks(checks []Check, commonConfig *Config, protocols []Protocol) <-chan Result {
+	var targets []CheckTarget
+	for _, c := range checks {
+		for _, protocol := range protocols {
+			targets = append(targets, CheckTarget{Check: c, Protocol: protocol})
+		}
+	}
+	return RunCheckTargets(targets, commonConfig)
+}
+
+func RunCheckTargets(targets []CheckTarget, commonConfig *Config) <-chan Result {
 	if commonConfig.Concurrency < 1 {
 		panic("concurrency should be >= 1")
 	}
 	ch := make(chan Result)
 	resultChForRunCheckCh := make(chan (<-chan Result), commonConfig.Concurrency-1)
+	var sharedServers *sharedServerPool
+	if serverLifecycleShared(commonConfig.ServerLifecycle) && commonConfig.ServerSchemalessUrl == "" {
+		sharedServers = newSharedServerPool()
+	}
 
 	go func() {
 		for resultChForRunCheck := range resultChForRunCheckCh {
 			for result := range resultChForRunCheck {
+				result.Server = commonConfig.ServerName
 				ch <- result
 			}
 		}
+		if sharedServers != nil {
+			sharedServers.stopAll()
+		}
 		close(ch)
 	}()
 
 	go func() {
-		for _, c := range checks {
-			for _, protocol := range protocols {
-				var resultChForRunCheck chan Result
-				resultChForRunCheck = make(chan Result, 128 /* subcheck waits if buffer size is less than the number of subchecks */)
-				resultChForRunCheckCh <- resultChForRunCheck
-				config := *commonConfig
-				config.Protocol = protocol
-				go func(c Check, config Config) {
-					// TODO: timeout for runCheck considering long-time check
-					runCheck(&c, &config, resultChForRunCheck)
-					close(resultChForRunCheck)
-				}(c, config)
+		for _, target := range targets {
+			var resultChForRunCheck chan Result
+			resultChForRunCheck = make(chan Result, 128 /* subcheck waits if buffer size is less than the number of subchecks */)
+			resultChForRunCheckCh <- resultChForRunCheck
+			config := *commonConfig
+			config.Protocol = target.Protocol
+			config.sharedServers = sharedServers
+			// Attempts of the check share the HAR. External checks send requests by themselves.
+			if config.HarDir != "" && !slices.Contains(target.Check.Tags, TagExternal) && (len(target.Check.Protocols) == 0 || slices.Contains(target.Check.Protocols, config.Protocol)) {
+				config.har = newHarRecorder(&config, target.Check.Name)
 			}
+			go func(c Check, config Config) {
+				runCheckAttempts(&c, &config, resultChForRunCheck)
+				// Results have the path, so the HAR should be written before they are all received
+				if config.har != nil {
+					if err := config.har.write(); err != nil {
+						fmt.Fprintf(os.Stderr, "failed to write HAR %s: %+v\n", config.har.path, err)
+					}
+				}
+				close(resultChForRunCheck)
+			}(target.Check, config)
 		}
 		close(resultChForRunCheckCh)
 	}()
@@ -0,0 +1,100 @@
+package check
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var externalCheckNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// NewExternalCheck returns a check which runs the executable. The check name is the file name without extension.
+// The executable gets PIPING_SERVER_URL, PIPING_PROTOCOL, PIPING_PATH (a fresh path) and PIPING_TLS_SKIP_VERIFY,
+// and prints RunCheckResult JSON lines such as {"subcheck_name": "transferred", "errors": [{"message": "..."}]} on stdout.
+func NewExternalCheck(executablePath string) (Check, error) {
+	name := strings.TrimSuffix(filepath.Base(executablePath), filepath.Ext(executablePath))
+	if !externalCheckNameRegexp.MatchString(name) {
+		return Check{}, fmt.Errorf("file name of external check should match %s: %s", externalCheckNameRegexp, executablePath)
+	}
+	if _, err := os.Stat(executablePath); err != nil {
+		return Check{}, err
+	}
+	return Check{
+		Name:        name,
+		Description: fmt.Sprintf("External check by %s", executablePath),
+		Tags:        []string{TagExternal},
+		timeout: func(config *Config) time.Duration {
+			return config.ExternalCheckTimeout + checkTimeoutMargin
+		},
+		run: func(config *Config, reporter RunCheckReporter) {
+			defer reporter.Close()
+			runExternalCheck(executablePath, config, reporter)
+		},
+	}, nil
+}
+
+func runExternalCheck(executablePath string, config *Config, reporter RunCheckReporter) {
+	serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
+	if !ok {
+		return
+	}
+	defer stopServerIfNeed()
+
+	// The process group is killed when the check times out
+	cmd := exec.CommandContext(reporter.ctx, executablePath)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"PIPING_SERVER_URL="+serverUrl,
+		"PIPING_PROTOCOL="+string(config.Protocol),
+		"PIPING_PATH=/"+uuid.NewString(),
+		"PIPING_TLS_SKIP_VERIFY="+strconv.FormatBool(config.TlsSkipVerifyCert),
+	)
+	stderr := newTailBuffer(serverLogTailSize)
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		reporter.Report(NewRunCheckResultWithOneError(NewError("failed to get stdout of external check", err)))
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		reporter.Report(NewRunCheckResultWithOneError(NewError("failed to run external check", err)))
+		return
+	}
+	nReports := 0
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var runCheckResult RunCheckResult
+		if err := json.Unmarshal([]byte(line), &runCheckResult); err != nil {
+			reporter.Report(NewRunCheckResultWithOneError(NewError(fmt.Sprintf("invalid output of external check: %s", line), err)))
+		} else {
+			reporter.Report(runCheckResult)
+		}
+		nReports++
+	}
+	if err := cmd.Wait(); err != nil {
+		reporter.Report(NewRunCheckResultWithOneError(NewError(fmt.Sprintf("external check failed, stderr: %s", stderr.String()), err)))
+		return
+	}
+	// An external check which prints nothing and exits with 0 passes
+	if nReports == 0 {
+		reporter.Report(RunCheckResult{})
+	}
+}
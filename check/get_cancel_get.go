@@ -14,16 +14,23 @@ import (
 
 func get_cancel_get() Check {
 	return Check{
-		Name: getCheckName(),
+		Name:          getCheckName(),
+		Description:   "A path is available after a receiver cancels",
+		SubCheckNames: []string{SubCheckNameProtocol},
+		Protocols:     AllProtocols(),
+		Tags:          []string{TagCancel},
+		timeout: func(config *Config) time.Duration {
+			return 2*config.GetReqWroteRequestWaitForH3 + config.WaitDurationBetweenReceiverWroteRequestAndCancel + config.WaitDurationAfterReceiverCancel + checkTimeoutMargin
+		},
 		run: func(config *Config, reporter RunCheckReporter) {
 			defer reporter.Close()
-			serverUrl, ok, stopServerIfNeed := prepareServerUrl(config, &reporter)
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
 			if !ok {
 				return
 			}
 			defer stopServerIfNeed()
 
-			getHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			getHttpClient := NewCheckHTTPClient(config)
 			defer getHttpClient.CloseIdleConnections()
 			path := "/" + uuid.NewString()
 			url := serverUrl + path
@@ -84,9 +91,9 @@ func get_cancel_get() Check {
 }
 
 func checkTransferForGetCancelGet(config *Config, url string, reporter RunCheckReporter) {
-	getHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+	getHttpClient := NewCheckHTTPClient(config)
 	defer getHttpClient.CloseIdleConnections()
-	postHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+	postHttpClient := NewCheckHTTPClient(config)
 	defer postHttpClient.CloseIdleConnections()
 
 	bodyString := "my message"
@@ -105,7 +112,7 @@ func checkTransferForGetCancelGet(config *Config, url string, reporter RunCheckR
 				getReqWroteRequestCh <- struct{}{}
 			},
 		}))
-		getResp, getOk := sendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+		getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
 		if !getOk {
 			return
 		}
@@ -127,7 +134,7 @@ func checkTransferForGetCancelGet(config *Config, url string, reporter RunCheckR
 			reporter.Report(RunCheckResult{Errors: []ResultError{NewError("failed to create POST request", err)}})
 			return
 		}
-		postResp, postOk := sendOrGetAndCheck(getHttpClient, postReq, config.Protocol, reporter)
+		postResp, postOk := SendOrGetAndCheck(getHttpClient, postReq, config.Protocol, reporter)
 		if !postOk {
 			return
 		}
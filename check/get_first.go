@@ -12,18 +12,25 @@ import (
 
 func get_first() Check {
 	return Check{
-		Name: getCheckName(),
+		Name:          getCheckName(),
+		Description:   "Transfer with the receiver's GET request first",
+		SubCheckNames: []string{SubCheckNameContentTypeForwarding, SubCheckNameXRobotsTagNone, SubCheckNameTransferred, SubCheckNameReusePath, SubCheckNameProtocol},
+		Protocols:     AllProtocols(),
+		Tags:          []string{TagBasic},
+		timeout: func(config *Config) time.Duration {
+			return config.GetReqWroteRequestWaitForH3 + 2*config.FixedLengthBodyGetTimeout + checkTimeoutMargin
+		},
 		run: func(config *Config, reporter RunCheckReporter) {
 			defer reporter.Close()
-			serverUrl, ok, stopServerIfNeed := prepareServerUrl(config, &reporter)
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
 			if !ok {
 				return
 			}
 			defer stopServerIfNeed()
 
-			postHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			postHttpClient := NewCheckHTTPClient(config)
 			defer postHttpClient.CloseIdleConnections()
-			getHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			getHttpClient := NewCheckHTTPClient(config)
 			defer getHttpClient.CloseIdleConnections()
 			path := "/" + uuid.NewString()
 			bodyString := "my message"
@@ -32,6 +39,7 @@ func get_first() Check {
 			contentType := "text/plain"
 			getRespOneshot := oneshot.NewOneshot[*http.Response]()
 			getReqWroteRequestCh := make(chan struct{})
+			var getTimer *transferTimer
 			go func() {
 				defer getRespOneshot.Done()
 				getReq, err := http.NewRequest("GET", url, nil)
@@ -44,10 +52,12 @@ func get_first() Check {
 						getReqWroteRequestCh <- struct{}{}
 					},
 				}))
-				getResp, getOk := sendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+				getReq, getTimer = traceTransfer(getReq)
+				getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
 				if !getOk {
 					return
 				}
+				getTimer.countBody(getResp)
 				getRespOneshot.Send(getResp)
 			}()
 
@@ -75,7 +85,7 @@ func get_first() Check {
 					return
 				}
 				postReq.Header.Set("Content-Type", contentType)
-				postResp, postOk := sendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
+				postResp, postOk := SendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
 				if !postOk {
 					return
 				}
@@ -110,7 +120,7 @@ func get_first() Check {
 				return
 			}
 
-			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred})
+			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred, Transfer: getTimer.timing()})
 
 			checkTransferForReusePath(config, url, reporter)
 			return
@@ -0,0 +1,453 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/nwtgck/piping-server-check/h2c_upgrade_round_tripper"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func h2_rst_stream() Check {
+	return Check{
+		Name:          getCheckName(),
+		Description:   "RST_STREAM on a receiver stream frees the path and keeps the HTTP/2 connection usable",
+		SubCheckNames: []string{SubCheckNameSenderTermination, SubCheckNameConnectionReuse, SubCheckNameReusePath, SubCheckNameProtocol},
+		// RST_STREAM is an HTTP/2 frame
+		Protocols: []Protocol{ProtocolH2, ProtocolH2c, ProtocolH2cUpgrade},
+		Tags:      []string{TagCancel, TagConnection},
+		timeout: func(config *Config) time.Duration {
+			return config.GetResponseReceivedTimeout + config.FirstByteCheckTimeout + config.WaitDurationAfterReceiverCancel + config.FixedLengthBodyGetTimeout + checkTimeoutMargin
+		},
+		run: func(config *Config, reporter RunCheckReporter) {
+			defer reporter.Close()
+			// Goroutines which report should finish before the reporter is closed
+			var wg sync.WaitGroup
+			defer wg.Wait()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
+			if !ok {
+				return
+			}
+			defer stopServerIfNeed()
+
+			postHttpClient := NewCheckHTTPClient(config)
+			defer postHttpClient.CloseIdleConnections()
+			path := "/" + uuid.NewString()
+			url := serverUrl + path
+
+			conn, err := dialH2RawConn(config, serverUrl)
+			if err != nil {
+				reporter.Report(NewRunCheckResultWithOneError(NewError("failed to establish HTTP/2 connection", err)))
+				return
+			}
+			defer conn.Close()
+
+			getStream1, err := conn.startGet(path)
+			if err != nil {
+				reporter.Report(NewRunCheckResultWithOneError(NewError("failed to send GET HEADERS frame", err)))
+				return
+			}
+
+			pr, pw := io.Pipe()
+			defer pr.Close()
+			senderFinishedCh := make(chan struct{})
+			var senderFinishOnce sync.Once
+			finishSender := func() { senderFinishOnce.Do(func() { close(senderFinishedCh) }) }
+			go func() {
+				var chunk [1024]byte
+				for {
+					if _, err := pw.Write(chunk[:]); err != nil {
+						finishSender()
+						return
+					}
+				}
+			}()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				postReq, err := http.NewRequestWithContext(ctx, "POST", url, pr)
+				if err != nil {
+					reporter.Report(NewRunCheckResultWithOneError(NewError("failed to create POST request", err)))
+					return
+				}
+				postResp, err := postHttpClient.Do(postReq)
+				if err != nil {
+					finishSender()
+					return
+				}
+				if resultErrors := CheckProtocol(postResp, config.Protocol); len(resultErrors) != 0 {
+					reporter.Report(RunCheckResult{SubCheckName: SubCheckNameProtocol, Errors: resultErrors})
+				}
+				// The sender response finishes when the server aborts the sender
+				io.Copy(io.Discard, postResp.Body)
+				postResp.Body.Close()
+				finishSender()
+			}()
+
+			select {
+			case status := <-getStream1.statusCh:
+				if status != 200 {
+					reporter.Report(NewRunCheckResultWithOneError(NewError(fmt.Sprintf("expected status=200 but status=%d found", status), nil)))
+					return
+				}
+			case <-getStream1.doneCh:
+				reporter.Report(NewRunCheckResultWithOneError(NewError("GET stream finished before receiving response", getStream1.err)))
+				return
+			case <-time.After(config.GetResponseReceivedTimeout):
+				reporter.Report(NewRunCheckResultWithOneError(NewError(fmt.Sprintf("failed to get receiver's response in %s", config.GetResponseReceivedTimeout), nil)))
+				return
+			}
+			// Wait for the first DATA frame to reset the stream in the middle of transfer
+			select {
+			case <-getStream1.dataCh:
+			case <-getStream1.doneCh:
+				reporter.Report(NewRunCheckResultWithOneError(NewError("GET stream finished before receiving data", getStream1.err)))
+				return
+			case <-time.After(config.FirstByteCheckTimeout):
+				reporter.Report(NewRunCheckResultWithOneError(NewError(fmt.Sprintf("failed to get first byte in %s", config.FirstByteCheckTimeout), nil)))
+				return
+			}
+			if err := conn.resetStream(getStream1, http2.ErrCodeCancel); err != nil {
+				reporter.Report(NewRunCheckResultWithOneError(NewError("failed to send RST_STREAM frame", err)))
+				return
+			}
+			reporter.Report(RunCheckResult{})
+
+			select {
+			case <-senderFinishedCh:
+				reporter.Report(RunCheckResult{SubCheckName: SubCheckNameSenderTermination})
+			case <-time.After(config.WaitDurationAfterReceiverCancel):
+				reporter.Report(RunCheckResult{SubCheckName: SubCheckNameSenderTermination, Errors: []ResultError{NewError(fmt.Sprintf("sender was not terminated in %s after receiver's RST_STREAM", config.WaitDurationAfterReceiverCancel), nil)}})
+			}
+
+			checkTransferForH2RstStream(ctx, &wg, config, conn, postHttpClient, path, url, reporter)
+			return
+		},
+	}
+}
+
+func checkTransferForH2RstStream(ctx context.Context, wg *sync.WaitGroup, config *Config, conn *h2RawConn, postHttpClient *http.Client, path string, url string, reporter RunCheckReporter) {
+	getStream, err := conn.startGet(path)
+	if err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNameConnectionReuse, Errors: []ResultError{NewError("failed to send GET HEADERS frame", err)}})
+		return
+	}
+
+	bodyString := "message for reuse"
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		postReq, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(bodyString))
+		if err != nil {
+			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameReusePath, Errors: []ResultError{NewError("failed to create POST request", err)}})
+			return
+		}
+		postResp, err := postHttpClient.Do(postReq)
+		if err != nil {
+			// Canceled because the check finished after the receiver got the whole body or failed
+			if ctx.Err() != nil {
+				return
+			}
+			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameReusePath, Errors: []ResultError{NewError("failed to POST", err)}})
+			return
+		}
+		io.Copy(io.Discard, postResp.Body)
+		postResp.Body.Close()
+	}()
+
+	timeout := time.After(config.FixedLengthBodyGetTimeout)
+	select {
+	case status := <-getStream.statusCh:
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNameConnectionReuse})
+		if status != 200 {
+			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameReusePath, Errors: []ResultError{NewError(fmt.Sprintf("expected status=200 but status=%d found", status), nil)}})
+			return
+		}
+	case <-getStream.doneCh:
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNameConnectionReuse, Errors: []ResultError{NewError("GET stream finished before receiving response", getStream.err)}})
+		return
+	case <-timeout:
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNameConnectionReuse, Errors: []ResultError{NewError(fmt.Sprintf("failed to receive a GET response in %v", config.FixedLengthBodyGetTimeout), nil)}})
+		return
+	}
+
+	var body bytes.Buffer
+	for {
+		select {
+		case <-getStream.dataCh:
+			data, err := conn.takeData(getStream)
+			if err != nil {
+				reporter.Report(RunCheckResult{SubCheckName: SubCheckNameReusePath, Errors: []ResultError{NewError("failed to send WINDOW_UPDATE frame", err)}})
+				return
+			}
+			body.Write(data)
+			continue
+		case <-getStream.doneCh:
+		case <-timeout:
+			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameReusePath, Errors: []ResultError{NewError(fmt.Sprintf("failed to read up in %v", config.FixedLengthBodyGetTimeout), nil)}})
+			return
+		}
+		break
+	}
+	// DATA frames which arrived together with END_STREAM. No WINDOW_UPDATE frame is sent for the finished stream.
+	data, _ := conn.takeData(getStream)
+	body.Write(data)
+	if getStream.err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNameReusePath, Errors: []ResultError{NewError("failed to read up", getStream.err)}})
+		return
+	}
+	if body.String() != bodyString {
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNameReusePath, Errors: []ResultError{NewError("message different", nil)}})
+		return
+	}
+	reporter.Report(RunCheckResult{SubCheckName: SubCheckNameReusePath})
+}
+
+// h2RawConn is a minimal HTTP/2 client connection to control frames directly
+type h2RawConn struct {
+	conn         net.Conn
+	framer       *http2.Framer
+	authority    string
+	scheme       string
+	writeMu      sync.Mutex
+	hpackBuf     bytes.Buffer
+	hpackEncoder *hpack.Encoder
+	streamsMu    sync.Mutex
+	streams      map[uint32]*h2RawStream
+	nextStreamId uint32
+}
+
+type h2RawStream struct {
+	id       uint32
+	statusCh chan int
+	// notified when data is buffered
+	dataCh chan struct{}
+	dataMu sync.Mutex
+	// The stream window is given back only when data is taken, so the server cannot send more than the window
+	data   bytes.Buffer
+	doneCh chan struct{}
+	// err is available after doneCh closed
+	err error
+}
+
+func dialH2RawConn(config *Config, serverUrl string) (*h2RawConn, error) {
+	parsedUrl, err := url.Parse(serverUrl)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	nextStreamId := uint32(1)
+	if protocolUsesTls(config.Protocol) {
+		tlsConn, err := tls.Dial("tcp", parsedUrl.Host, &tls.Config{InsecureSkipVerify: config.TlsSkipVerifyCert, NextProtos: []string{http2.NextProtoTLS}})
+		if err != nil {
+			return nil, err
+		}
+		if negotiated := tlsConn.ConnectionState().NegotiatedProtocol; negotiated != http2.NextProtoTLS {
+			tlsConn.Close()
+			return nil, fmt.Errorf("expected ALPN %s but %s negotiated", http2.NextProtoTLS, negotiated)
+		}
+		conn = tlsConn
+	} else {
+		conn, err = net.Dial("tcp", parsedUrl.Host)
+		if err != nil {
+			return nil, err
+		}
+		if config.Protocol == ProtocolH2cUpgrade {
+			upgradedConn, err := h2c_upgrade_round_tripper.UpgradeConn(conn, parsedUrl.Host, "/")
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			conn = upgradedConn
+			// 1 is used by the upgrade request. Its response is ignored.
+			nextStreamId = 3
+		}
+	}
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c := &h2RawConn{
+		conn:         conn,
+		framer:       http2.NewFramer(conn, conn),
+		authority:    parsedUrl.Host,
+		scheme:       parsedUrl.Scheme,
+		streams:      make(map[uint32]*h2RawStream),
+		nextStreamId: nextStreamId,
+	}
+	c.framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	c.hpackEncoder = hpack.NewEncoder(&c.hpackBuf)
+	if err := c.framer.WriteSettings(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *h2RawConn) readLoop() {
+	var err error
+	defer func() {
+		c.streamsMu.Lock()
+		defer c.streamsMu.Unlock()
+		for id, stream := range c.streams {
+			stream.err = fmt.Errorf("connection closed: %w", err)
+			close(stream.doneCh)
+			delete(c.streams, id)
+		}
+	}()
+	for {
+		var frame http2.Frame
+		frame, err = c.framer.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				c.writeMu.Lock()
+				err = c.framer.WriteSettingsAck()
+				c.writeMu.Unlock()
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				c.writeMu.Lock()
+				err = c.framer.WritePing(true, f.Data)
+				c.writeMu.Unlock()
+			}
+		case *http2.GoAwayFrame:
+			err = fmt.Errorf("GOAWAY received: %s", f.ErrCode)
+		case *http2.MetaHeadersFrame:
+			if stream := c.stream(f.StreamID); stream != nil {
+				if status, convErr := strconv.Atoi(f.PseudoValue("status")); convErr == nil {
+					select {
+					case stream.statusCh <- status:
+					default:
+						// Ignore trailers
+					}
+				}
+				if f.StreamEnded() {
+					c.finishStream(stream, nil)
+				}
+			}
+		case *http2.DataFrame:
+			if len(f.Data()) != 0 {
+				// The connection window is given back immediately not to block other streams
+				c.writeMu.Lock()
+				err = c.framer.WriteWindowUpdate(0, uint32(len(f.Data())))
+				c.writeMu.Unlock()
+			}
+			if stream := c.stream(f.StreamID); stream != nil {
+				stream.dataMu.Lock()
+				stream.data.Write(f.Data())
+				stream.dataMu.Unlock()
+				select {
+				case stream.dataCh <- struct{}{}:
+				default:
+					// Already notified
+				}
+				if f.StreamEnded() {
+					c.finishStream(stream, nil)
+				}
+			}
+		case *http2.RSTStreamFrame:
+			if stream := c.stream(f.StreamID); stream != nil {
+				c.finishStream(stream, fmt.Errorf("RST_STREAM received: %s", f.ErrCode))
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *h2RawConn) stream(id uint32) *h2RawStream {
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+	return c.streams[id]
+}
+
+// takeData returns the buffered data of the stream and gives back the stream window for it
+func (c *h2RawConn) takeData(stream *h2RawStream) ([]byte, error) {
+	stream.dataMu.Lock()
+	data := append([]byte(nil), stream.data.Bytes()...)
+	stream.data.Reset()
+	stream.dataMu.Unlock()
+	if len(data) == 0 || c.stream(stream.id) == nil {
+		return data, nil
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return data, c.framer.WriteWindowUpdate(stream.id, uint32(len(data)))
+}
+
+func (c *h2RawConn) finishStream(stream *h2RawStream, err error) {
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+	if _, ok := c.streams[stream.id]; !ok {
+		return
+	}
+	stream.err = err
+	close(stream.doneCh)
+	delete(c.streams, stream.id)
+}
+
+func (c *h2RawConn) startGet(path string) (*h2RawStream, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.hpackBuf.Reset()
+	for _, field := range []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: c.scheme},
+		{Name: ":authority", Value: c.authority},
+		{Name: ":path", Value: path},
+	} {
+		if err := c.hpackEncoder.WriteField(field); err != nil {
+			return nil, err
+		}
+	}
+	stream := &h2RawStream{
+		id:       c.nextStreamId,
+		statusCh: make(chan int, 1),
+		dataCh:   make(chan struct{}, 1),
+		doneCh:   make(chan struct{}),
+	}
+	c.nextStreamId += 2
+	c.streamsMu.Lock()
+	c.streams[stream.id] = stream
+	c.streamsMu.Unlock()
+	err := c.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      stream.id,
+		BlockFragment: c.hpackBuf.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (c *h2RawConn) resetStream(stream *h2RawStream, code http2.ErrCode) error {
+	c.finishStream(stream, nil)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.framer.WriteRSTStream(stream.id, code)
+}
+
+func (c *h2RawConn) Close() error {
+	return c.conn.Close()
+}
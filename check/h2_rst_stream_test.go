@@ -0,0 +1,84 @@
+package check
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newH2cMiniPipingServer() *httptest.Server {
+	return httptest.NewServer(h2c.NewHandler(newMiniPipingHandler(), &http2.Server{}))
+}
+
+func TestH2RstStream(t *testing.T) {
+	server := newH2cMiniPipingServer()
+	defer server.Close()
+	config := Config{
+		Concurrency:                     1,
+		ServerSchemalessUrl:             strings.TrimPrefix(server.URL, "http:"),
+		GetResponseReceivedTimeout:      3 * time.Second,
+		FirstByteCheckTimeout:           3 * time.Second,
+		WaitDurationAfterReceiverCancel: 3 * time.Second,
+		FixedLengthBodyGetTimeout:       3 * time.Second,
+	}
+	var results []Result
+	for result := range RunChecks([]Check{h2_rst_stream()}, &config, []Protocol{ProtocolH2c, ProtocolH2cUpgrade}) {
+		results = append(results, result)
+	}
+	for _, protocol := range []Protocol{ProtocolH2c, ProtocolH2cUpgrade} {
+		var names []string
+		for _, result := range results {
+			if result.Protocol != protocol {
+				continue
+			}
+			assert.Equal(t, ResultStatusOk, result.Status, "%s %s: %+v", protocol, result.Name, result.Errors)
+			names = append(names, result.Name)
+		}
+		assert.ElementsMatch(t, []string{"h2_rst_stream", "h2_rst_stream.sender_termination", "h2_rst_stream.connection_reuse", "h2_rst_stream.reuse_path"}, names)
+	}
+}
+
+func TestH2RawConnReceivesBodyLargerThanWindow(t *testing.T) {
+	server := newH2cMiniPipingServer()
+	defer server.Close()
+	body := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	for _, protocol := range []Protocol{ProtocolH2c, ProtocolH2cUpgrade} {
+		config := Config{Protocol: protocol}
+		conn, err := dialH2RawConn(&config, server.URL)
+		assert.NoError(t, err)
+		getStream, err := conn.startGet("/large")
+		assert.NoError(t, err)
+		go func() {
+			resp, err := http.Post(server.URL+"/large", "", bytes.NewReader(body))
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		var received bytes.Buffer
+		timeout := time.After(5 * time.Second)
+	loop:
+		for {
+			select {
+			case <-getStream.dataCh:
+				data, err := conn.takeData(getStream)
+				assert.NoError(t, err)
+				received.Write(data)
+			case <-getStream.doneCh:
+				break loop
+			case <-timeout:
+				t.Fatalf("%s: timeout after %d bytes", protocol, received.Len())
+			}
+		}
+		data, _ := conn.takeData(getStream)
+		received.Write(data)
+		assert.NoError(t, getStream.err)
+		assert.Equal(t, len(body), received.Len(), protocol)
+		conn.Close()
+	}
+}
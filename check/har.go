@@ -0,0 +1,345 @@
+package check
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/nwtgck/piping-server-check/version"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// harRecorder records HTTP exchanges of a check in a protocol and writes them as HAR 1.2
+type harRecorder struct {
+	path        string
+	maxBodySize int64
+	mu          sync.Mutex
+	exchanges   []*harExchange
+}
+
+// harExchange is updated while the request and response bodies are transferred
+type harExchange struct {
+	startTime        time.Time
+	wroteRequestTime time.Time
+	headersTime      time.Time
+	endTime          time.Time
+	method           string
+	url              string
+	requestProto     string
+	requestHeader    http.Header
+	requestBody      *harBody
+	// zero if no response
+	status         int
+	statusText     string
+	proto          string
+	responseHeader http.Header
+	responseBody   *harBody
+	err            error
+}
+
+type harBody struct {
+	captured bytes.Buffer
+	size     int64
+}
+
+func newHarRecorder(config *Config, checkName string) *harRecorder {
+	path := filepath.Join(config.HarDir, config.ServerName, string(config.Protocol), checkName+".har")
+	return &harRecorder{path: path, maxBodySize: config.HarMaxBodySize}
+}
+
+// harRoundTripper records exchanges of base
+type harRoundTripper struct {
+	base     http.RoundTripper
+	recorder *harRecorder
+}
+
+func (t *harRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := t.recorder
+	exchange := &harExchange{startTime: time.Now(), method: req.Method, url: req.URL.String(), requestProto: req.Proto, requestHeader: req.Header.Clone()}
+	r.mu.Lock()
+	r.exchanges = append(r.exchanges, exchange)
+	r.mu.Unlock()
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			exchange.wroteRequestTime = time.Now()
+		},
+	}))
+	if req.Body != nil && req.Body != http.NoBody {
+		exchange.requestBody = &harBody{}
+		req.Body = &harBodyReader{ReadCloser: req.Body, recorder: r, body: exchange.requestBody}
+	}
+	resp, err := t.base.RoundTrip(req)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	exchange.headersTime = time.Now()
+	if err != nil {
+		exchange.err = err
+		exchange.endTime = exchange.headersTime
+		return nil, err
+	}
+	exchange.status = resp.StatusCode
+	exchange.statusText = http.StatusText(resp.StatusCode)
+	exchange.proto = resp.Proto
+	exchange.responseHeader = resp.Header.Clone()
+	exchange.responseBody = &harBody{}
+	resp.Body = &harBodyReader{ReadCloser: resp.Body, recorder: r, body: exchange.responseBody, end: func() {
+		exchange.endTime = time.Now()
+	}}
+	return resp, nil
+}
+
+// CloseIdleConnections is called by http.Client.CloseIdleConnections
+func (t *harRoundTripper) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// harBodyReader captures the first bytes of a body up to maxBodySize
+type harBodyReader struct {
+	io.ReadCloser
+	recorder *harRecorder
+	body     *harBody
+	// called once on EOF, an error or Close
+	end func()
+}
+
+func (b *harBodyReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.recorder.mu.Lock()
+	defer b.recorder.mu.Unlock()
+	b.body.size += int64(n)
+	if remaining := b.recorder.maxBodySize - int64(b.body.captured.Len()); remaining > 0 {
+		b.body.captured.Write(p[:min(int64(n), remaining)])
+	}
+	if err != nil {
+		b.callEnd()
+	}
+	return n, err
+}
+
+func (b *harBodyReader) Close() error {
+	err := b.ReadCloser.Close()
+	b.recorder.mu.Lock()
+	defer b.recorder.mu.Unlock()
+	b.callEnd()
+	return err
+}
+
+// callEnd should be called with the lock
+func (b *harBodyReader) callEnd() {
+	if b.end != nil {
+		b.end()
+		b.end = nil
+	}
+}
+
+// HAR 1.2: http://www.softwareishard.com/blog/har-12-spec/
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	Url         string         `json:"url"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// -1 means not available
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	Dns     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Ssl     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	nameValues := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			nameValues = append(nameValues, harNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(nameValues, func(i, j int) bool { return nameValues[i].Name < nameValues[j].Name })
+	return nameValues
+}
+
+// harBodyText returns base64 encoding for non-UTF-8 bodies and a comment for truncated ones
+func harBodyText(body *harBody) (text string, encoding string, comment string) {
+	captured := body.captured.Bytes()
+	if utf8.Valid(captured) {
+		text = string(captured)
+	} else {
+		text = base64.StdEncoding.EncodeToString(captured)
+		encoding = "base64"
+	}
+	if int64(len(captured)) < body.size {
+		comment = fmt.Sprintf("truncated to %d of %d bytes", len(captured), body.size)
+	}
+	return
+}
+
+// entry should be called with the lock
+func (e *harExchange) entry() *harEntry {
+	// The actual protocol is in the response
+	proto := e.proto
+	if proto == "" {
+		proto = e.requestProto
+	}
+	entry := &harEntry{
+		StartedDateTime: e.startTime,
+		Request: harRequest{
+			Method:      e.method,
+			Url:         e.url,
+			HttpVersion: proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(e.requestHeader),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+		},
+		Response: harResponse{
+			Status:      e.status,
+			StatusText:  e.statusText,
+			HttpVersion: e.proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(e.responseHeader),
+			Content:     harContent{MimeType: "x-unknown"},
+			HeadersSize: -1,
+		},
+		Timings: harTimings{Blocked: -1, Dns: -1, Connect: -1, Ssl: -1},
+	}
+	if e.requestBody != nil {
+		entry.Request.BodySize = e.requestBody.size
+		text, encoding, comment := harBodyText(e.requestBody)
+		// postData has no encoding field
+		if encoding != "" {
+			comment = strings.TrimSuffix(encoding+" encoded, "+comment, ", ")
+		}
+		entry.Request.PostData = &harPostData{MimeType: e.requestHeader.Get("Content-Type"), Text: text, Comment: comment}
+	}
+	if e.responseBody != nil {
+		entry.Response.BodySize = e.responseBody.size
+		entry.Response.Content.Size = e.responseBody.size
+		if contentType := e.responseHeader.Get("Content-Type"); contentType != "" {
+			entry.Response.Content.MimeType = contentType
+		}
+		entry.Response.Content.Text, entry.Response.Content.Encoding, entry.Response.Content.Comment = harBodyText(e.responseBody)
+	}
+	if e.err != nil {
+		entry.Comment = fmt.Sprintf("error: %+v", e.err)
+	}
+
+	// Not finished exchanges are until now. The request body can be sent after the response headers.
+	headersTime, endTime := e.headersTime, e.endTime
+	if headersTime.IsZero() {
+		headersTime = time.Now()
+		entry.Comment = "no response"
+	}
+	if endTime.IsZero() {
+		endTime = time.Now()
+	}
+	if e.wroteRequestTime.IsZero() || e.wroteRequestTime.After(headersTime) {
+		entry.Timings.Wait = durationMs(headersTime.Sub(e.startTime))
+	} else {
+		entry.Timings.Send = durationMs(e.wroteRequestTime.Sub(e.startTime))
+		entry.Timings.Wait = durationMs(headersTime.Sub(e.wroteRequestTime))
+	}
+	entry.Timings.Receive = durationMs(endTime.Sub(headersTime))
+	entry.Time = entry.Timings.Send + entry.Timings.Wait + entry.Timings.Receive
+	return entry
+}
+
+// write writes exchanges so far. Exchanges in progress are written as they are.
+func (r *harRecorder) write() error {
+	r.mu.Lock()
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "piping-server-check", Version: version.Version},
+		Entries: []*harEntry{},
+	}}
+	for _, exchange := range r.exchanges {
+		har.Log.Entries = append(har.Log.Entries, exchange.entry())
+	}
+	r.mu.Unlock()
+	harBytes, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, harBytes, 0644)
+}
@@ -0,0 +1,61 @@
+package check
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello, world"))
+	}))
+	defer server.Close()
+	harCheck := newServerCheck("har", func(config *Config, serverUrl string, reporter RunCheckReporter) {
+		httpClient := NewCheckHTTPClient(config)
+		defer httpClient.CloseIdleConnections()
+		req, err := http.NewRequest("POST", serverUrl+"/har", strings.NewReader("my message"))
+		if err != nil {
+			reporter.Report(NewRunCheckResultWithOneError(NewError("failed to create request", err)))
+			return
+		}
+		resp, ok := SendOrGetAndCheck(httpClient, req, config.Protocol, reporter)
+		if !ok {
+			return
+		}
+		checkSenderRespReadUp("", resp, reporter)
+		reporter.Report(RunCheckResult{})
+	}).WithTimeout(func(config *Config) time.Duration { return 5 * time.Second })
+	harDir := t.TempDir()
+	config := Config{Concurrency: 1, ServerSchemalessUrl: strings.TrimPrefix(server.URL, "http:"), HarDir: harDir, HarMaxBodySize: 5}
+	var results []Result
+	for result := range RunChecks([]Check{harCheck}, &config, []Protocol{ProtocolHttp1_1}) {
+		results = append(results, result)
+	}
+	harPath := filepath.Join(harDir, "http1.1", "har.har")
+	assert.Len(t, results, 1)
+	assert.Equal(t, harPath, results[0].HarPath)
+
+	harBytes, err := os.ReadFile(harPath)
+	assert.NoError(t, err)
+	var har harFile
+	assert.NoError(t, json.Unmarshal(harBytes, &har))
+	assert.Equal(t, "1.2", har.Log.Version)
+	assert.Len(t, har.Log.Entries, 1)
+	entry := har.Log.Entries[0]
+	assert.Equal(t, "POST", entry.Request.Method)
+	assert.Equal(t, server.URL+"/har", entry.Request.Url)
+	assert.Equal(t, &harPostData{Text: "my me", Comment: "truncated to 5 of 10 bytes"}, entry.Request.PostData)
+	assert.Equal(t, 200, entry.Response.Status)
+	assert.Equal(t, "HTTP/1.1", entry.Response.HttpVersion)
+	assert.Contains(t, entry.Response.Headers, harNameValue{Name: "Content-Type", Value: "text/plain"})
+	assert.Equal(t, harContent{Size: 12, MimeType: "text/plain", Text: "hello", Comment: "truncated to 5 of 12 bytes"}, entry.Response.Content)
+	assert.Greater(t, entry.Time, float64(0))
+}
@@ -9,7 +9,8 @@ import (
 	"time"
 )
 
-func checkProtocol(resp *http.Response, expectedProto Protocol) []ResultError {
+// CheckProtocol returns errors if resp is not in the protocol
+func CheckProtocol(resp *http.Response, expectedProto Protocol) []ResultError {
 	var resultErrors []ResultError
 	var versionOk bool
 	switch expectedProto {
@@ -17,7 +18,7 @@ func checkProtocol(resp *http.Response, expectedProto Protocol) []ResultError {
 		versionOk = resp.Proto == "HTTP/1.0"
 	case ProtocolHttp1_1, ProtocolHttp1_1_tls:
 		versionOk = resp.Proto == "HTTP/1.1"
-	case ProtocolH2, ProtocolH2c:
+	case ProtocolH2, ProtocolH2c, ProtocolH2cUpgrade:
 		versionOk = resp.Proto == "HTTP/2.0"
 	case ProtocolH3:
 		versionOk = resp.Proto == "HTTP/3.0"
@@ -35,13 +36,14 @@ func checkProtocol(resp *http.Response, expectedProto Protocol) []ResultError {
 	return resultErrors
 }
 
-func sendOrGetAndCheck(httpClient *http.Client, req *http.Request, protocol Protocol, reporter RunCheckReporter) (*http.Response, bool) {
+// SendOrGetAndCheck reports errors if the request fails, the protocol is unexpected or the status is not 200
+func SendOrGetAndCheck(httpClient *http.Client, req *http.Request, protocol Protocol, reporter RunCheckReporter) (*http.Response, bool) {
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		reporter.Report(NewRunCheckResultWithOneError(NewError(fmt.Sprintf("failed to %s", req.Method), err)))
 		return nil, false
 	}
-	if resultErrors := checkProtocol(resp, protocol); len(resultErrors) != 0 {
+	if resultErrors := CheckProtocol(resp, protocol); len(resultErrors) != 0 {
 		reporter.Report(RunCheckResult{SubCheckName: SubCheckNameProtocol, Errors: resultErrors})
 	}
 	if resp.StatusCode != 200 {
@@ -79,9 +81,9 @@ func checkXRobotsTag(getResp *http.Response, reporter RunCheckReporter) {
 }
 
 func checkTransferForReusePath(config *Config, url string, reporter RunCheckReporter) {
-	getHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+	getHttpClient := NewCheckHTTPClient(config)
 	defer getHttpClient.CloseIdleConnections()
-	postHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+	postHttpClient := NewCheckHTTPClient(config)
 	defer postHttpClient.CloseIdleConnections()
 
 	bodyString := "message for reuse"
@@ -94,7 +96,7 @@ func checkTransferForReusePath(config *Config, url string, reporter RunCheckRepo
 			reporter.Report(NewRunCheckResultWithOneError(NewError("failed to create GET request", err)))
 			return
 		}
-		getResp, getOk := sendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+		getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
 		if !getOk {
 			return
 		}
@@ -109,7 +111,7 @@ func checkTransferForReusePath(config *Config, url string, reporter RunCheckRepo
 			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameReusePath, Errors: []ResultError{NewError("failed to create POST request", err)}})
 			return
 		}
-		postResp, postOk := sendOrGetAndCheck(getHttpClient, postReq, config.Protocol, reporter)
+		postResp, postOk := SendOrGetAndCheck(getHttpClient, postReq, config.Protocol, reporter)
 		if !postOk {
 			return
 		}
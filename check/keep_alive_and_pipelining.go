@@ -0,0 +1,213 @@
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/nwtgck/piping-server-check/oneshot"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func keep_alive_and_pipelining() Check {
+	return Check{
+		Name:          getCheckName(),
+		Description:   "HTTP/1.1 keep-alive connection reuse and pipelined requests",
+		SubCheckNames: []string{SubCheckNameKeepAlive, SubCheckNamePipelining, SubCheckNameProtocol},
+		// Only HTTP/1.1 has keep-alive and pipelining
+		Protocols: []Protocol{ProtocolHttp1_1, ProtocolHttp1_1_tls},
+		Tags:      []string{TagConnection},
+		timeout: func(config *Config) time.Duration {
+			return 3*config.FixedLengthBodyGetTimeout + checkTimeoutMargin
+		},
+		run: func(config *Config, reporter RunCheckReporter) {
+			defer reporter.Close()
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
+			if !ok {
+				return
+			}
+			defer stopServerIfNeed()
+
+			getHttpClient := NewCheckHTTPClient(config)
+			defer getHttpClient.CloseIdleConnections()
+
+			checkKeepAlive(config, serverUrl, getHttpClient, reporter)
+			checkPipelining(config, serverUrl, getHttpClient, reporter)
+			return
+		},
+	}
+}
+
+func checkKeepAlive(config *Config, serverUrl string, getHttpClient *http.Client, reporter RunCheckReporter) {
+	conn, err := dialRawHttp1_1Conn(config, serverUrl)
+	if err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNameKeepAlive, Errors: []ResultError{NewError("failed to connect", err)}})
+		return
+	}
+	defer conn.Close()
+	connReader := bufio.NewReader(conn)
+	// The second transfer reuses the connection after the first one finishes
+	for i := 0; i < 2; i++ {
+		if _, ok := transferOnRawConn(SubCheckNameKeepAlive, config, conn, connReader, serverUrl+"/"+uuid.NewString(), nil, getHttpClient, reporter); !ok {
+			return
+		}
+	}
+	reporter.Report(RunCheckResult{SubCheckName: SubCheckNameKeepAlive})
+}
+
+func checkPipelining(config *Config, serverUrl string, getHttpClient *http.Client, reporter RunCheckReporter) {
+	conn, err := dialRawHttp1_1Conn(config, serverUrl)
+	if err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNamePipelining, Errors: []ResultError{NewError("failed to connect", err)}})
+		return
+	}
+	defer conn.Close()
+	connReader := bufio.NewReader(conn)
+	parsedUrl, err := url.Parse(serverUrl)
+	if err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNamePipelining, Errors: []ResultError{NewError("failed to parse server URL", err)}})
+		return
+	}
+	// The reserved path responds without waiting for a sender. A path prefix of the server URL is not kept because the prefixed path is a transfer path.
+	reservedUrl := (&url.URL{Scheme: parsedUrl.Scheme, Host: parsedUrl.Host, Path: config.ReservedPath}).String()
+	pipelinedReq, err := http.NewRequest("GET", reservedUrl, nil)
+	if err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNamePipelining, Errors: []ResultError{NewError("failed to create GET request", err)}})
+		return
+	}
+	pipelinedResp, ok := transferOnRawConn(SubCheckNamePipelining, config, conn, connReader, serverUrl+"/"+uuid.NewString(), pipelinedReq, getHttpClient, reporter)
+	if !ok {
+		return
+	}
+	if !(200 <= pipelinedResp.StatusCode && pipelinedResp.StatusCode < 300) {
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNamePipelining, Errors: []ResultError{NewError(fmt.Sprintf("expected 2xx status of pipelined GET %s but status=%d found", config.ReservedPath, pipelinedResp.StatusCode), nil)}})
+		return
+	}
+	reporter.Report(RunCheckResult{SubCheckName: SubCheckNamePipelining})
+}
+
+func dialRawHttp1_1Conn(config *Config, serverUrl string) (net.Conn, error) {
+	parsedUrl, err := url.Parse(serverUrl)
+	if err != nil {
+		return nil, err
+	}
+	if protocolUsesTls(config.Protocol) {
+		return tls.Dial("tcp", parsedUrl.Host, &tls.Config{InsecureSkipVerify: config.TlsSkipVerifyCert, NextProtos: []string{"http/1.1"}})
+	}
+	return net.Dial("tcp", parsedUrl.Host)
+}
+
+// transferOnRawConn sends a POST request on conn and pipelines pipelinedReq behind it if not nil
+func transferOnRawConn(subcheckName string, config *Config, conn net.Conn, connReader *bufio.Reader, url string, pipelinedReq *http.Request /* nil OK */, getHttpClient *http.Client, reporter RunCheckReporter) (pipelinedResp *http.Response, ok bool) {
+	bodyString := "my message"
+	postReq, err := http.NewRequest("POST", url, strings.NewReader(bodyString))
+	if err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("failed to create POST request", err)}})
+		return nil, false
+	}
+	var reqBuff bytes.Buffer
+	if err := postReq.Write(&reqBuff); err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("failed to serialize POST request", err)}})
+		return nil, false
+	}
+	if pipelinedReq != nil {
+		if err := pipelinedReq.Write(&reqBuff); err != nil {
+			reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError(fmt.Sprintf("failed to serialize %s request", pipelinedReq.Method), err)}})
+			return nil, false
+		}
+	}
+	// Each read has its own deadline not to use up the time of the pipelined response by a slow first response
+	setDeadline := func(setDeadline func(time.Time) error) bool {
+		if err := setDeadline(time.Now().Add(config.FixedLengthBodyGetTimeout)); err != nil {
+			reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("failed to set deadline", err)}})
+			return false
+		}
+		return true
+	}
+	defer conn.SetDeadline(time.Time{})
+	if !setDeadline(conn.SetWriteDeadline) {
+		return nil, false
+	}
+	if _, err := conn.Write(reqBuff.Bytes()); err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("failed to send requests", err)}})
+		return nil, false
+	}
+
+	getRespOneshot := oneshot.NewOneshot[*http.Response]()
+	go func() {
+		defer getRespOneshot.Done()
+		getReq, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("failed to create GET request", err)}})
+			return
+		}
+		getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+		if !getOk {
+			return
+		}
+		getRespOneshot.Send(getResp)
+	}()
+	getResp, ok := respWithTimeout(subcheckName, "GET", getRespOneshot, config.FixedLengthBodyGetTimeout, reporter)
+	if !ok {
+		return nil, false
+	}
+	bodyBytes, err := io.ReadAll(getResp.Body)
+	if err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("failed to read up", err)}})
+		return nil, false
+	}
+	if ok := checkCloseReceiverRespBody(getResp, reporter); !ok {
+		return nil, false
+	}
+	if string(bodyBytes) != bodyString {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("message different", nil)}})
+		return nil, false
+	}
+
+	if !setDeadline(conn.SetReadDeadline) {
+		return nil, false
+	}
+	postResp, err := http.ReadResponse(connReader, postReq)
+	if err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("failed to read POST response", err)}})
+		return nil, false
+	}
+	if postResp.Proto != "HTTP/1.1" {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError(fmt.Sprintf("expected HTTP/1.1 but %s", postResp.Proto), nil)}})
+		return nil, false
+	}
+	if postResp.StatusCode != 200 {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError(fmt.Sprintf("expected status=200 but status=%d found", postResp.StatusCode), nil)}})
+		return nil, false
+	}
+	if ok := checkSenderRespReadUp(subcheckName, postResp, reporter); !ok {
+		return nil, false
+	}
+	if postResp.Close {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError("server closes the connection after the POST response", nil)}})
+		return nil, false
+	}
+	if pipelinedReq == nil {
+		return nil, true
+	}
+
+	if !setDeadline(conn.SetReadDeadline) {
+		return nil, false
+	}
+	pipelinedResp, err = http.ReadResponse(connReader, pipelinedReq)
+	if err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError(fmt.Sprintf("failed to read pipelined %s response", pipelinedReq.Method), err)}})
+		return nil, false
+	}
+	if _, err := io.Copy(io.Discard, pipelinedResp.Body); err != nil {
+		reporter.Report(RunCheckResult{SubCheckName: subcheckName, Errors: []ResultError{NewError(fmt.Sprintf("failed to read pipelined %s response body", pipelinedReq.Method), err)}})
+		return nil, false
+	}
+	return pipelinedResp, true
+}
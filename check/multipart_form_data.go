@@ -15,18 +15,25 @@ import (
 
 func multipart_form_data() Check {
 	return Check{
-		Name: getCheckName(),
+		Name:          getCheckName(),
+		Description:   "Transfer a file part of multipart/form-data",
+		SubCheckNames: []string{SubCheckNameContentTypeForwarding, SubCheckNameContentDispositionForwarding, SubCheckNameTransferred, SubCheckNameProtocol},
+		Protocols:     AllProtocols(),
+		Tags:          []string{TagBasic},
+		timeout: func(config *Config) time.Duration {
+			return config.SenderResponseBeforeReceiverTimeout + config.GetResponseReceivedTimeout + checkTimeoutMargin
+		},
 		run: func(config *Config, reporter RunCheckReporter) {
 			defer reporter.Close()
-			serverUrl, ok, stopServerIfNeed := prepareServerUrl(config, &reporter)
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
 			if !ok {
 				return
 			}
 			defer stopServerIfNeed()
 
-			postHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			postHttpClient := NewCheckHTTPClient(config)
 			defer postHttpClient.CloseIdleConnections()
-			getHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			getHttpClient := NewCheckHTTPClient(config)
 			defer getHttpClient.CloseIdleConnections()
 			path := "/" + uuid.NewString()
 			url := serverUrl + path
@@ -70,7 +77,7 @@ func multipart_form_data() Check {
 				}
 				ensureContentLengthExits(postReq)
 				postReq.Header.Set("Content-Type", contentType)
-				postResp, postOk := sendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
+				postResp, postOk := SendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
 				if !postOk {
 					return
 				}
@@ -86,6 +93,7 @@ func multipart_form_data() Check {
 			}
 
 			getRespOneshot := oneshot.NewOneshot[*http.Response]()
+			var getTimer *transferTimer
 			go func() {
 				defer getRespOneshot.Done()
 				getReq, err := http.NewRequest("GET", url, nil)
@@ -93,10 +101,12 @@ func multipart_form_data() Check {
 					reporter.Report(NewRunCheckResultWithOneError(NewError("failed to create request", err)))
 					return
 				}
-				getResp, getOk := sendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+				getReq, getTimer = traceTransfer(getReq)
+				getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
 				if !getOk {
 					return
 				}
+				getTimer.countBody(getResp)
 				getRespOneshot.Send(getResp)
 			}()
 
@@ -130,7 +140,7 @@ func multipart_form_data() Check {
 			if ok := checkSenderRespReadUp(SubCheckNameTransferred, postResp, reporter); !ok {
 				return
 			}
-			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred})
+			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred, Transfer: getTimer.timing()})
 			return
 		},
 	}
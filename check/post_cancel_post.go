@@ -10,21 +10,24 @@ import (
 
 func post_cancel_post() Check {
 	return Check{
-		Name: getCheckName(),
+		Name:          getCheckName(),
+		Description:   "A path is available after a sender cancels",
+		SubCheckNames: []string{SubCheckNameProtocol},
+		// TODO: implement for HTTP/1.0
+		Protocols: protocolsExcept(ProtocolHttp1_0, ProtocolHttp1_0_tls),
+		Tags:      []string{TagCancel},
+		timeout: func(config *Config) time.Duration {
+			return config.WaitDurationAfterSenderCancel + checkTimeoutMargin
+		},
 		run: func(config *Config, reporter RunCheckReporter) {
 			defer reporter.Close()
-			// TODO: implement for HTTP/1.0
-			if config.Protocol == ProtocolHttp1_0 || config.Protocol == ProtocolHttp1_0_tls {
-				reporter.Report(RunCheckResult{Warnings: []ResultWarning{NewWarning("Sorry. This check does not support HTTP/1.0 yet", nil)}})
-				return
-			}
-			serverUrl, ok, stopServerIfNeed := prepareServerUrl(config, &reporter)
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
 			if !ok {
 				return
 			}
 			defer stopServerIfNeed()
 
-			postHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			postHttpClient := NewCheckHTTPClient(config)
 			defer postHttpClient.CloseIdleConnections()
 			path := "/" + uuid.NewString()
 			bodyString := "my message"
@@ -40,7 +43,7 @@ func post_cancel_post() Check {
 				ctx, cancel := context.WithCancel(context.Background())
 				postReq1 = postReq1.WithContext(ctx)
 				postReq1.Header.Set("Content-Type", contentType)
-				postResp1, postOk := sendOrGetAndCheck(postHttpClient, postReq1, config.Protocol, reporter)
+				postResp1, postOk := SendOrGetAndCheck(postHttpClient, postReq1, config.Protocol, reporter)
 				if !postOk {
 					return
 				}
@@ -62,7 +65,7 @@ func post_cancel_post() Check {
 					return
 				}
 				postReq2.Header.Set("Content-Type", contentType)
-				_, postOk := sendOrGetAndCheck(postHttpClient, postReq2, config.Protocol, reporter)
+				_, postOk := SendOrGetAndCheck(postHttpClient, postReq2, config.Protocol, reporter)
 				if !postOk {
 					return
 				}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/nwtgck/piping-server-check/oneshot"
-	"golang.org/x/exp/slices"
 	"io"
 	"net/http"
 	"time"
@@ -12,22 +11,26 @@ import (
 
 func post_first_byte_by_byte_streaming() Check {
 	return Check{
-		Name: getCheckName(),
+		Name:          getCheckName(),
+		Description:   "Stream a body byte by byte from a sender to a receiver",
+		SubCheckNames: []string{SubCheckNameTransferred, SubCheckNameProtocol},
+		// HTTP/1.0 has not chunked encoding
+		Protocols: protocolsExcept(ProtocolHttp1_0, ProtocolHttp1_0_tls),
+		Tags:      []string{TagStreaming},
+		timeout: func(config *Config) time.Duration {
+			return config.SenderResponseBeforeReceiverTimeout + config.GetResponseReceivedTimeout + config.FirstByteCheckTimeout + checkTimeoutMargin
+		},
 		run: func(config *Config, reporter RunCheckReporter) {
 			defer reporter.Close()
-			if slices.Contains([]Protocol{ProtocolHttp1_0, ProtocolHttp1_0_tls}, config.Protocol) {
-				// Skip because HTTP/1.0 has not chunked encoding
-				return
-			}
-			serverUrl, ok, stopServerIfNeed := prepareServerUrl(config, &reporter)
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
 			if !ok {
 				return
 			}
 			defer stopServerIfNeed()
 
-			postHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			postHttpClient := NewCheckHTTPClient(config)
 			defer postHttpClient.CloseIdleConnections()
-			getHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			getHttpClient := NewCheckHTTPClient(config)
 			defer getHttpClient.CloseIdleConnections()
 			path := "/" + uuid.NewString()
 			url := serverUrl + path
@@ -41,7 +44,7 @@ func post_first_byte_by_byte_streaming() Check {
 					reporter.Report(NewRunCheckResultWithOneError(NewError("failed to create request", err)))
 					return
 				}
-				postResp, postOk := sendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
+				postResp, postOk := SendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
 				if !postOk {
 					return
 				}
@@ -62,6 +65,7 @@ func post_first_byte_by_byte_streaming() Check {
 			}
 
 			getRespOneshot := oneshot.NewOneshot[*http.Response]()
+			var getTimer *transferTimer
 			go func() {
 				defer getRespOneshot.Done()
 				getReq, err := http.NewRequest("GET", url, nil)
@@ -69,10 +73,12 @@ func post_first_byte_by_byte_streaming() Check {
 					reporter.Report(NewRunCheckResultWithOneError(NewError("failed to create request", err)))
 					return
 				}
-				getResp, getOk := sendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+				getReq, getTimer = traceTransfer(getReq)
+				getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
 				if !getOk {
 					return
 				}
+				getTimer.countBody(getResp)
 				getRespOneshot.Send(getResp)
 			}()
 
@@ -148,7 +154,7 @@ func post_first_byte_by_byte_streaming() Check {
 			if ok := checkSenderRespReadUp(SubCheckNameTransferred, postResp, reporter); !ok {
 				return
 			}
-			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred})
+			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred, Transfer: getTimer.timing()})
 			return
 		},
 	}
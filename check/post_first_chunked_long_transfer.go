@@ -6,7 +6,6 @@ import (
 	"github.com/google/uuid"
 	"github.com/nwtgck/piping-server-check/oneshot"
 	"github.com/nwtgck/piping-server-check/util"
-	"golang.org/x/exp/slices"
 	"io"
 	"math/rand"
 	"net/http"
@@ -15,27 +14,35 @@ import (
 
 func post_first_chunked_long_transfer() Check {
 	return Check{
-		Name: getCheckName(),
+		Name:          getCheckName(),
+		Description:   "Long transfer with chunked encoding in --transfer-span",
+		SubCheckNames: []string{SubCheckNamePartialTransfer, SubCheckNameTransferred, SubCheckNameProtocol},
+		// HTTP/1.0 has not chunked encoding
+		// TODO: create both long-transfer with chunked encoding and long-transfer with Content-Length
+		Protocols: protocolsExcept(ProtocolHttp1_0, ProtocolHttp1_0_tls),
+		Tags:      []string{TagStreaming, TagLong},
+		timeout: func(config *Config) time.Duration {
+			var longestSpan time.Duration
+			if len(config.SortedTransferSpans) != 0 {
+				longestSpan = config.SortedTransferSpans[len(config.SortedTransferSpans)-1]
+			}
+			return config.SenderResponseBeforeReceiverTimeout + config.GetResponseReceivedTimeout + longestSpan + checkTimeoutMargin
+		},
 		run: func(config *Config, reporter RunCheckReporter) {
 			defer reporter.Close()
 			if len(config.SortedTransferSpans) == 0 {
-				// skipped
-				return
-			}
-			if slices.Contains([]Protocol{ProtocolHttp1_0, ProtocolHttp1_0_tls}, config.Protocol) {
-				// Skip because HTTP/1.0 has not chunked encoding
-				// TODO: create both long-transfer with chunked encoding and long-transfer with Content-Length
+				reporter.Report(NewRunCheckResultSkipped("no --transfer-span specified"))
 				return
 			}
-			serverUrl, ok, stopServerIfNeed := prepareServerUrl(config, &reporter)
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
 			if !ok {
 				return
 			}
 			defer stopServerIfNeed()
 
-			postHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			postHttpClient := NewCheckHTTPClient(config)
 			defer postHttpClient.CloseIdleConnections()
-			getHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			getHttpClient := NewCheckHTTPClient(config)
 			defer getHttpClient.CloseIdleConnections()
 			path := "/" + uuid.NewString()
 			url := serverUrl + path
@@ -52,7 +59,7 @@ func post_first_chunked_long_transfer() Check {
 					reporter.Report(NewRunCheckResultWithOneError(NewError("failed to create request", err)))
 					return
 				}
-				postResp, postOk := sendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
+				postResp, postOk := SendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
 				if !postOk {
 					return
 				}
@@ -68,6 +75,7 @@ func post_first_chunked_long_transfer() Check {
 			}
 
 			getRespOneshot := oneshot.NewOneshot[*http.Response]()
+			var getTimer *transferTimer
 			go func() {
 				defer getRespOneshot.Done()
 				getReq, err := http.NewRequest("GET", url, nil)
@@ -75,10 +83,12 @@ func post_first_chunked_long_transfer() Check {
 					reporter.Report(NewRunCheckResultWithOneError(NewError("failed to create request", err)))
 					return
 				}
-				getResp, getOk := sendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+				getReq, getTimer = traceTransfer(getReq)
+				getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
 				if !getOk {
 					return
 				}
+				getTimer.countBody(getResp)
 				getRespOneshot.Send(getResp)
 			}()
 
@@ -137,7 +147,7 @@ func post_first_chunked_long_transfer() Check {
 			if ok := checkSenderRespReadUp(SubCheckNameTransferred, postResp, reporter); !ok {
 				return
 			}
-			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred})
+			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred, Transfer: getTimer.timing()})
 			return
 		},
 	}
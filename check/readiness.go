@@ -0,0 +1,178 @@
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 2xx (or Config.HealthCheckExpectedStatus) of Config.HealthCheckPath
+	ReadinessStrategyHealthCheck = "health_check"
+	// a line of stdout or stderr matches Config.ReadinessLogRegex
+	ReadinessStrategyLog = "log"
+	// the server port is listening (UDP for HTTP/3)
+	ReadinessStrategyPort = "port"
+)
+
+func AllReadinessStrategies() []string {
+	return []string{ReadinessStrategyHealthCheck, ReadinessStrategyLog, ReadinessStrategyPort}
+}
+
+// waitServerReady returns nil when the server is ready and ctx.Err() when ctx is done
+func waitServerReady(ctx context.Context, config *Config, serverUrl string, serverPort string, logMatched <-chan struct{} /* nil OK */) error {
+	switch config.ReadinessStrategy {
+	case "", ReadinessStrategyHealthCheck:
+		client := NewHTTPClient(config.Protocol, true /* always skip verification for health check */)
+		defer client.CloseIdleConnections()
+		return waitHTTPServer(ctx, client, config.HealthCheckMethod, serverUrl+config.HealthCheckPath, config.HealthCheckExpectedStatus)
+	case ReadinessStrategyLog:
+		select {
+		case <-logMatched:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case ReadinessStrategyPort:
+		if config.Protocol == ProtocolH3 {
+			return waitUDPPortListening(ctx, serverPort)
+		}
+		return waitTCPPortListening(ctx, serverPort)
+	}
+	return fmt.Errorf("unknown readiness strategy: %s", config.ReadinessStrategy)
+}
+
+func waitHTTPServer(ctx context.Context, httpClient *http.Client, method string /* empty string means GET */, healthCheckUrl string, expectedStatus int /* 0 means 2xx */) error {
+	if method == "" {
+		method = "GET"
+	}
+	for first := true; ; first = false {
+		wait := 200 * time.Millisecond
+		if first {
+			wait = 100 * time.Millisecond
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		req, err := http.NewRequestWithContext(ctx, method, healthCheckUrl, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if (expectedStatus == 0 && 200 <= resp.StatusCode && resp.StatusCode < 300) || resp.StatusCode == expectedStatus {
+			return nil
+		}
+	}
+}
+
+func waitTCPPortListening(ctx context.Context, port string) error {
+	for {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("localhost", port))
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// UDP has no handshake, so sockets in /proc/net/udp and /proc/net/udp6 are looked up. Only Linux is supported.
+func waitUDPPortListening(ctx context.Context, port string) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("readiness strategy %s for %s is supported only on Linux, use %s or %s instead", ReadinessStrategyPort, ProtocolH3, ReadinessStrategyHealthCheck, ReadinessStrategyLog)
+	}
+	portInt, err := strconv.Atoi(port)
+	if err != nil {
+		return err
+	}
+	// local_address is "<hex IP>:<hex port>"
+	localPortSuffix := fmt.Sprintf(":%04X", portInt)
+	for {
+		for _, path := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+			procBytes, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			scanner := bufio.NewScanner(bytes.NewReader(procBytes))
+			for scanner.Scan() {
+				fields := strings.Fields(scanner.Text())
+				if len(fields) >= 2 && strings.HasSuffix(fields[1], localPortSuffix) {
+					return nil
+				}
+			}
+		}
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// logLineMatcher closes matched when a line matches the regex. The same matcher can be written by stdout and stderr via writer().
+type logLineMatcher struct {
+	regex     *regexp.Regexp
+	matched   chan struct{}
+	matchOnce sync.Once
+}
+
+func newLogLineMatcher(regex *regexp.Regexp) *logLineMatcher {
+	return &logLineMatcher{regex: regex, matched: make(chan struct{})}
+}
+
+// writer returns a writer for one stream because lines are buffered separately
+func (m *logLineMatcher) writer() *logLineMatcherWriter {
+	return &logLineMatcherWriter{matcher: m}
+}
+
+type logLineMatcherWriter struct {
+	matcher *logLineMatcher
+	line    []byte
+}
+
+func (w *logLineMatcherWriter) Write(p []byte) (int, error) {
+	// Logs after the match are not buffered nor matched
+	select {
+	case <-w.matcher.matched:
+		w.line = nil
+		return len(p), nil
+	default:
+	}
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i == -1 {
+			break
+		}
+		if w.matcher.regex.Match(w.line[:i]) {
+			w.matcher.matchOnce.Do(func() { close(w.matcher.matched) })
+		}
+		w.line = w.line[i+1:]
+	}
+	// A ready message may not end with a newline
+	if w.matcher.regex.Match(w.line) {
+		w.matcher.matchOnce.Do(func() { close(w.matcher.matched) })
+	}
+	return len(p), nil
+}
@@ -0,0 +1,29 @@
+package check
+
+import (
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestLogLineMatcherWriter(t *testing.T) {
+	matcher := newLogLineMatcher(regexp.MustCompile("^ready$"))
+	stdout := matcher.writer()
+	stderr := matcher.writer()
+	stdout.Write([]byte("starting\nrea"))
+	stderr.Write([]byte("dy\n"))
+	select {
+	case <-matcher.matched:
+		t.Fatal("lines of different streams should not be joined")
+	default:
+	}
+	stdout.Write([]byte("dy\n"))
+	<-matcher.matched
+	// Logs after the match are passed through without buffering
+	n, err := stdout.Write([]byte("no newline"))
+	assert.NoError(t, err)
+	assert.Equal(t, len("no newline"), n)
+	assert.Empty(t, stdout.line)
+	stderr.Write([]byte("ready\n"))
+	assert.Empty(t, stderr.line)
+}
@@ -4,6 +4,12 @@ import (
 	"fmt"
 	_ "github.com/k0kubun/pp/v3" // Not used but do not remove. It is useful to create tests
 	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -32,13 +38,428 @@ func TestRunServerCommandFailed(t *testing.T) {
 	}
 	protocols := []Protocol{ProtocolHttp1_1}
 	for result := range RunChecks(checks, &config, protocols) {
-		if result.Name != simultaneous_request().Name {
+		if result.Name != simultaneous_request().Name && result.Status != ResultStatusSkipped {
 			assert.NotNil(t, result.Errors)
 			assert.Regexp(t, "(.*error on purpose.*)|(.*exit status 1.*)", result.Errors[0].Message)
 		}
 	}
 }
 
+// newServerCheck returns a check which calls run with the URL of the server prepared by PrepareServerUrl
+func newServerCheck(name string, run func(config *Config, serverUrl string, reporter RunCheckReporter)) Check {
+	return Check{
+		Name: name,
+		run: func(config *Config, reporter RunCheckReporter) {
+			defer reporter.Close()
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
+			if !ok {
+				return
+			}
+			defer stopServerIfNeed()
+			run(config, serverUrl, reporter)
+		},
+	}
+}
+
+// reportOk is run of newServerCheck which only reports an ok result
+func reportOk(config *Config, serverUrl string, reporter RunCheckReporter) {
+	reporter.Report(RunCheckResult{})
+}
+
+func TestServerLogTailWithoutServerLogDir(t *testing.T) {
+	serverCheck := newServerCheck("server_check", reportOk)
+	config := Config{
+		RunServerCmd:      []string{"sh", "-c", "echo 'error on purpose' > /dev/stderr && exit 1"},
+		Concurrency:       1,
+		ReadinessStrategy: ReadinessStrategyLog,
+		ReadinessLogRegex: "^ready$",
+	}
+	var results []Result
+	for result := range RunChecks([]Check{serverCheck}, &config, []Protocol{ProtocolHttp1_1}) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 1)
+	assert.Equal(t, ResultStatusError, results[0].Status)
+	assert.Empty(t, results[0].ServerStderrLogPath)
+	assert.Equal(t, "error on purpose\n", results[0].ServerLogTail.Stderr)
+}
+
+func TestRunChecksTimeout(t *testing.T) {
+	hangingCheck := Check{
+		Name:    "hanging",
+		timeout: func(config *Config) time.Duration { return 100 * time.Millisecond },
+		run: func(config *Config, reporter RunCheckReporter) {
+			defer reporter.Close()
+			reporter.Report(RunCheckResult{SubCheckName: "before_hang"})
+			select {}
+		},
+	}
+	config := Config{Concurrency: 1}
+	protocols := []Protocol{ProtocolHttp1_1}
+	var results []Result
+	for result := range RunChecks([]Check{hangingCheck, hangingCheck}, &config, protocols) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 4)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, "hanging.before_hang", results[i*2].Name)
+		assert.Equal(t, "hanging", results[i*2+1].Name)
+		assert.Equal(t, "check timed out in 100ms", results[i*2+1].Errors[0].Message)
+	}
+}
+
+func TestRunChecksTimeoutExcludesServerStartUp(t *testing.T) {
+	serverCheck := newServerCheck("server_check", reportOk).WithTimeout(func(config *Config) time.Duration { return 100 * time.Millisecond })
+	config := Config{
+		RunServerCmd:      []string{"sh", "-c", "sleep 100"},
+		Concurrency:       1,
+		ReadinessStrategy: ReadinessStrategyLog,
+		ReadinessLogRegex: "^ready$",
+		ReadinessTimeout:  500 * time.Millisecond,
+	}
+	var results []Result
+	for result := range RunChecks([]Check{serverCheck}, &config, []Protocol{ProtocolHttp1_1}) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 1)
+	assert.Regexp(t, "^server not ready in 500ms", results[0].Errors[0].Message)
+}
+
+func TestRunChecksTimeoutIncludesTimeBeforeServerStartUp(t *testing.T) {
+	serverCheck := Check{
+		Name:    "server_check",
+		timeout: func(config *Config) time.Duration { return 300 * time.Millisecond },
+		run: func(config *Config, reporter RunCheckReporter) {
+			defer reporter.Close()
+			// Time before and after PrepareServerUrl is charged but not restarted
+			time.Sleep(200 * time.Millisecond)
+			_, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
+			if !ok {
+				return
+			}
+			defer stopServerIfNeed()
+			time.Sleep(200 * time.Millisecond)
+			reporter.Report(RunCheckResult{})
+		},
+	}
+	config := Config{Concurrency: 1, ServerSchemalessUrl: "//localhost:1"}
+	var results []Result
+	for result := range RunChecks([]Check{serverCheck}, &config, []Protocol{ProtocolHttp1_1}) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 1)
+	assert.Equal(t, "check timed out in 300ms", results[0].Errors[0].Message)
+}
+
+func TestRunChecksSharedServer(t *testing.T) {
+	reportingCheck := func(name string, durationAfterReport time.Duration) Check {
+		return newServerCheck(name, func(config *Config, serverUrl string, reporter RunCheckReporter) {
+			reporter.Report(RunCheckResult{})
+			time.Sleep(durationAfterReport)
+		})
+	}
+	runChecks := func(serverCommand string, checks []Check) []Result {
+		config := Config{
+			RunServerCmd:      []string{"sh", "-c", serverCommand},
+			Concurrency:       1,
+			ReadinessStrategy: ReadinessStrategyLog,
+			ReadinessLogRegex: "^ready$",
+			ServerLifecycle:   ServerLifecyclePerRun,
+		}
+		var results []Result
+		for result := range RunChecks(checks, &config, []Protocol{ProtocolHttp1_1, ProtocolH2c}) {
+			results = append(results, result)
+		}
+		return results
+	}
+
+	t.Run("shared", func(t *testing.T) {
+		results := runChecks("echo ready && sleep 100", []Check{reportingCheck("check1", 0), reportingCheck("check2", 0)})
+		assert.Len(t, results, 4)
+		for _, result := range results {
+			assert.Equal(t, ResultStatusOk, result.Status)
+			assert.Equal(t, results[0].ServerRunId, result.ServerRunId)
+		}
+	})
+
+	t.Run("crash", func(t *testing.T) {
+		results := runChecks("echo ready && sleep 0.5", []Check{reportingCheck("check1", 1*time.Second)})
+		assert.Len(t, results, 4)
+		assert.Equal(t, ResultStatusOk, results[0].Status)
+		assert.Equal(t, "check1", results[1].Name)
+		assert.Equal(t, ResultStatusError, results[1].Status)
+		assert.Regexp(t, "^shared server .* exited during the check", results[1].Errors[0].Message)
+		// restarted
+		assert.Equal(t, ResultStatusOk, results[2].Status)
+		assert.NotEqual(t, results[0].ServerRunId, results[2].ServerRunId)
+	})
+}
+
+func TestServerPortsReleasedOnUnexpectedExit(t *testing.T) {
+	config := Config{RunServerCmd: []string{"sh", "-c", "exit 1"}}
+	server, resultErrors := startServerRun(&config, generateServerRunId())
+	assert.Empty(t, resultErrors)
+	<-server.exited
+	assert.False(t, portPool.IsReserved(server.httpPort))
+	assert.False(t, portPool.IsReserved(server.httpsPort))
+}
+
+func TestSharedServerCrashError(t *testing.T) {
+	exited := make(chan struct{})
+	close(exited)
+	exitedAt := time.Now()
+	s := &sharedServer{server: &startedServer{id: "R_1", logs: &serverLogs{stderrTail: newTailBuffer(10)}, exited: exited, exitedAt: exitedAt}}
+	// The check started before the exit
+	assert.NotNil(t, s.crashError(exitedAt.Add(-time.Second)))
+	// The exit is charged to an earlier check
+	assert.Nil(t, s.crashError(exitedAt.Add(time.Second)))
+}
+
+func TestServerResourcesOfSharedServer(t *testing.T) {
+	reportingCheck := func(name string, durationBeforeReport time.Duration) Check {
+		return newServerCheck(name, func(config *Config, serverUrl string, reporter RunCheckReporter) {
+			time.Sleep(durationBeforeReport)
+			reporter.Report(RunCheckResult{})
+		})
+	}
+	config := Config{
+		// The server uses CPU only in the first second
+		RunServerCmd:                 []string{"sh", "-c", "echo ready; (while :; do :; done) & sleep 1; kill $!; sleep 100"},
+		Concurrency:                  1,
+		ReadinessStrategy:            ReadinessStrategyLog,
+		ReadinessLogRegex:            "^ready$",
+		ServerLifecycle:              ServerLifecyclePerRun,
+		ServerResourceSampleInterval: 50 * time.Millisecond,
+	}
+	var results []Result
+	for result := range RunChecks([]Check{reportingCheck("check1", 1500*time.Millisecond), reportingCheck("check2", 500*time.Millisecond)}, &config, []Protocol{ProtocolHttp1_1}) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 2)
+	assert.Equal(t, results[0].ServerRunId, results[1].ServerRunId)
+	assert.Greater(t, results[0].ServerResources.Peak.CpuSeconds, 0.5)
+	// CPU time in the first check is not charged to the second check
+	assert.Less(t, results[1].ServerResources.Peak.CpuSeconds, 0.2)
+	assert.Equal(t, results[1].ServerResources.Peak.CpuSeconds, results[1].ServerResources.Final.CpuSeconds)
+}
+
+func TestServerResourceSampleInterval(t *testing.T) {
+	// off by default
+	assert.Equal(t, time.Duration(0), serverResourceSampleInterval(&Config{}))
+	assert.Equal(t, 100*time.Millisecond, serverResourceSampleInterval(&Config{ServerResourceSampleInterval: 100 * time.Millisecond}))
+	assert.Equal(t, defaultServerResourceSampleInterval, serverResourceSampleInterval(&Config{ServerResourceWarningThreshold: ServerResourceThreshold{Fds: 100}}))
+	assert.Equal(t, defaultServerResourceSampleInterval, serverResourceSampleInterval(&Config{ServerResourceErrorThreshold: ServerResourceThreshold{RssBytes: 1 << 30}}))
+	assert.Greater(t, procClockTicksPerSecond(), float64(0))
+}
+
+func TestNewCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	customCheck := NewCheck(Check{Name: "custom", Protocols: []Protocol{ProtocolHttp1_1}}, func(config *Config, reporter RunCheckReporter) {
+		defer reporter.Close()
+		serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
+		if !ok {
+			return
+		}
+		defer stopServerIfNeed()
+		httpClient := NewCheckHTTPClient(config)
+		defer httpClient.CloseIdleConnections()
+		req, err := http.NewRequest("GET", serverUrl+"/custom", nil)
+		if err != nil {
+			reporter.Report(NewRunCheckResultWithOneError(NewError("failed to create request", err)))
+			return
+		}
+		if _, ok := SendOrGetAndCheck(httpClient, req, config.Protocol, reporter); !ok {
+			return
+		}
+		reporter.Report(RunCheckResult{SubCheckName: "hello"})
+	}).WithTimeout(func(config *Config) time.Duration { return 5 * time.Second })
+	assert.NotNil(t, NewCheck(Check{Name: "no_timeout"}, func(config *Config, reporter RunCheckReporter) {}).timeout)
+	config := Config{Concurrency: 1, ServerSchemalessUrl: strings.TrimPrefix(server.URL, "http:")}
+	var results []Result
+	for result := range RunChecks([]Check{customCheck}, &config, []Protocol{ProtocolHttp1_1, ProtocolH2c}) {
+		clearResultTiming(&result)
+		results = append(results, result)
+	}
+	ok := true
+	assert.Equal(t, []Result{
+		{Name: "custom.hello", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: &ok},
+		{Name: "custom", Protocol: ProtocolH2c, Status: ResultStatusSkipped, SkipReason: "h2c is not supported"},
+	}, results)
+}
+
+func TestResultTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	timingCheck := NewCheck(Check{Name: "timing"}, func(config *Config, reporter RunCheckReporter) {
+		defer reporter.Close()
+		req, err := http.NewRequest("GET", server.URL, nil)
+		if err != nil {
+			reporter.Report(NewRunCheckResultWithOneError(NewError("failed to create request", err)))
+			return
+		}
+		req, timer := traceTransfer(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			reporter.Report(NewRunCheckResultWithOneError(NewError("failed to get", err)))
+			return
+		}
+		timer.countBody(resp)
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred, Transfer: timer.timing()})
+	}).WithTimeout(func(config *Config) time.Duration { return 5 * time.Second })
+	beforeRun := time.Now()
+	config := Config{Concurrency: 1}
+	var results []Result
+	for result := range RunChecks([]Check{timingCheck}, &config, []Protocol{ProtocolHttp1_1}) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 1)
+	assert.False(t, results[0].StartedAt.Before(beforeRun))
+	assert.Equal(t, durationMs(results[0].Duration), results[0].DurationMs)
+	assert.NotNil(t, results[0].Transfer)
+	assert.Equal(t, int64(len("hello")), results[0].Transfer.Bytes)
+	assert.Greater(t, results[0].Transfer.TtfbMs, float64(0))
+}
+
+// clearResultTiming clears unpredictable timing fields
+func clearResultTiming(result *Result) {
+	result.StartedAt = time.Time{}
+	result.Duration = 0
+	result.DurationMs = 0
+	result.ServerReadyMs = 0
+	result.Transfer = nil
+}
+
+func TestExternalCheck(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "my_external.sh")
+	script := `#!/bin/sh
+echo "{\"subcheck_name\": \"env\", \"message\": \"$PIPING_SERVER_URL $PIPING_PROTOCOL\"}"
+echo '{"subcheck_name": "failed", "errors": [{"message": "error on purpose"}]}'
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		panic(err)
+	}
+	externalCheck, err := NewExternalCheck(scriptPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "my_external", externalCheck.Name)
+	config := Config{Concurrency: 1, ServerSchemalessUrl: "//localhost:1234", ExternalCheckTimeout: 5 * time.Second}
+	var results []Result
+	for result := range RunChecks([]Check{externalCheck}, &config, []Protocol{ProtocolHttp1_1}) {
+		clearResultTiming(&result)
+		results = append(results, result)
+	}
+	ok := true
+	assert.Equal(t, []Result{
+		{Name: "my_external.env", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, Message: "http://localhost:1234 http1.1", OkForJson: &ok},
+		{Name: "my_external.failed", Protocol: ProtocolHttp1_1, Status: ResultStatusError, Errors: []ResultError{{Message: "error on purpose"}}},
+	}, results)
+}
+
+func TestRunChecksFlaky(t *testing.T) {
+	newFailingFirstCheck := func() Check {
+		nAttempts := 0
+		return Check{
+			Name: "failing_first",
+			run: func(config *Config, reporter RunCheckReporter) {
+				defer reporter.Close()
+				nAttempts++
+				if nAttempts == 1 {
+					reporter.Report(NewRunCheckResultWithOneError(NewError("error on purpose", nil)))
+					return
+				}
+				reporter.Report(RunCheckResult{})
+			},
+		}
+	}
+	protocols := []Protocol{ProtocolHttp1_1}
+
+	config := Config{Concurrency: 1, Repeat: 3}
+	var results []Result
+	for result := range RunChecks([]Check{newFailingFirstCheck()}, &config, protocols) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 1)
+	assert.Equal(t, ResultStatusFlaky, results[0].Status)
+	// Decided when the second attempt passes
+	assert.Equal(t, &ResultAttempts{Passed: 1, Failed: 1}, results[0].Attempts)
+
+	config = Config{Concurrency: 1, RetryFailed: 3}
+	results = nil
+	for result := range RunChecks([]Check{newFailingFirstCheck()}, &config, protocols) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 1)
+	assert.Equal(t, ResultStatusFlaky, results[0].Status)
+	// No more retry after the check passes
+	assert.Equal(t, &ResultAttempts{Passed: 1, Failed: 1}, results[0].Attempts)
+
+	// The failed attempt reports the check name and the passed attempt reports a sub check name
+	nAttempts := 0
+	differentNamesCheck := Check{
+		Name: "different_names",
+		run: func(config *Config, reporter RunCheckReporter) {
+			defer reporter.Close()
+			nAttempts++
+			if nAttempts == 1 {
+				reporter.Report(NewRunCheckResultWithOneError(NewError("error on purpose", nil)))
+				return
+			}
+			reporter.Report(RunCheckResult{SubCheckName: "sub"})
+		},
+	}
+	config = Config{Concurrency: 1, RetryFailed: 3}
+	results = nil
+	for result := range RunChecks([]Check{differentNamesCheck}, &config, protocols) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 2)
+	assert.Equal(t, "different_names", results[0].Name)
+	assert.Equal(t, ResultStatusFlaky, results[0].Status)
+	assert.Equal(t, &ResultAttempts{Passed: 1, Failed: 1}, results[0].Attempts)
+	assert.Equal(t, "different_names.sub", results[1].Name)
+	assert.Equal(t, ResultStatusOk, results[1].Status)
+
+	// A flaky result is sent before the remaining attempts finish
+	nAttempts = 0
+	lastAttemptCanFinish := make(chan struct{})
+	streamingCheck := Check{
+		Name: "streaming",
+		run: func(config *Config, reporter RunCheckReporter) {
+			defer reporter.Close()
+			nAttempts++
+			switch nAttempts {
+			case 1:
+				reporter.Report(RunCheckResult{})
+			case 2:
+				reporter.Report(RunCheckResult{SubCheckName: "sub", Errors: []ResultError{NewError("error on purpose", nil)}})
+				reporter.Report(RunCheckResult{})
+			case 3:
+				<-lastAttemptCanFinish
+				reporter.Report(RunCheckResult{})
+			}
+		},
+	}
+	config = Config{Concurrency: 1, Repeat: 3}
+	resultCh := RunChecks([]Check{streamingCheck}, &config, protocols)
+	result := <-resultCh
+	assert.Equal(t, "streaming.sub", result.Name)
+	assert.Equal(t, ResultStatusFlaky, result.Status)
+	assert.Equal(t, &ResultAttempts{Passed: 1, Failed: 1}, result.Attempts)
+	close(lastAttemptCanFinish)
+	result = <-resultCh
+	assert.Equal(t, "streaming", result.Name)
+	assert.Equal(t, ResultStatusOk, result.Status)
+	assert.Equal(t, &ResultAttempts{Passed: 2, Failed: 1}, result.Attempts)
+	_, ok := <-resultCh
+	assert.False(t, ok)
+}
+
 func TestRunChecksForHTTP1_0(t *testing.T) {
 	keyPath, certPath, removeKeyAndCert, err := createKeyAndCert()
 	if err != nil {
@@ -63,6 +484,7 @@ func TestRunChecksForHTTP1_0(t *testing.T) {
 	protocols := []Protocol{ProtocolHttp1_0, ProtocolHttp1_0_tls}
 	var errorResultNames []string
 	var warningResultNames []string
+	var skippedResultNames []string
 	var results []Result
 	for result := range RunChecks(checks, &config, protocols) {
 		results = append(results, result)
@@ -72,6 +494,9 @@ func TestRunChecksForHTTP1_0(t *testing.T) {
 		if len(result.Warnings) != 0 {
 			warningResultNames = append(warningResultNames, result.Name)
 		}
+		if result.Status == ResultStatusSkipped {
+			skippedResultNames = append(skippedResultNames, result.Name)
+		}
 		assert.Contains(t, []Protocol{ProtocolHttp1_0, ProtocolHttp1_0_tls}, result.Protocol)
 	}
 	assert.ElementsMatch(t, []string{
@@ -83,9 +508,23 @@ func TestRunChecksForHTTP1_0(t *testing.T) {
 		"post_first.sender_response_before_receiver",
 		"put.sender_response_before_receiver",
 		"put.sender_response_before_receiver",
+	}, warningResultNames)
+	assert.ElementsMatch(t, []string{
 		"post_cancel_post",
 		"post_cancel_post",
-	}, warningResultNames)
+		"post_first_byte_by_byte_streaming",
+		"post_first_byte_by_byte_streaming",
+		"h2_rst_stream",
+		"h2_rst_stream",
+		"alt_svc",
+		"alt_svc",
+		"keep_alive_and_pipelining",
+		"keep_alive_and_pipelining",
+		"slow_headers_isolation",
+		"slow_headers_isolation",
+		"post_first_chunked_long_transfer",
+		"post_first_chunked_long_transfer",
+	}, skippedResultNames)
 }
 
 func TestRunChecksForHTTP1_1(t *testing.T) {
@@ -104,6 +543,7 @@ func TestRunChecksForHTTP1_1(t *testing.T) {
 		FixedLengthBodyGetTimeout:                        3 * time.Second,
 		ServiceWorkerRejectionTimeout:                    1 * time.Second,
 		NSimultaneousRequests:                            1,
+		ReservedPath:                                     "/version",
 	}
 	protocols := []Protocol{ProtocolHttp1_1}
 	var results []Result
@@ -112,39 +552,46 @@ func TestRunChecksForHTTP1_1(t *testing.T) {
 		result.Message = ""
 		// server run ID is not predictable
 		result.ServerRunId = ""
+		// durations are not predictable
+		clearResultTiming(&result)
 		results = append(results, result)
 	}
 	truePointer := new(bool)
 	*truePointer = true
 	expected := []Result{
-		{Name: "post_first.sender_response_before_receiver", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_first.same_path_sender_rejection", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_first.content_type_forwarding", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_first.x_robots_tag_none", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_first.transferred", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_first.reuse_path", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "get_first.content_type_forwarding", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "get_first.x_robots_tag_none", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "get_first.transferred", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "get_first.reuse_path", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "put.sender_response_before_receiver", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "put.same_path_sender_rejection", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "put.content_type_forwarding", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "put.x_robots_tag_none", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "put.transferred", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "put.reuse_path", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_cancel_post", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "get_cancel_get", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "service_worker_registration_rejection", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_first_byte_by_byte_streaming.transferred", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "multipart_form_data.content_type_forwarding", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "multipart_form_data.content_disposition_forwarding", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "multipart_form_data.transferred", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "simultaneous_request", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_first_chunked_long_transfer.partial_transfer", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_first_chunked_long_transfer.partial_transfer", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_first_chunked_long_transfer.partial_transfer", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
-		{Name: "post_first_chunked_long_transfer.transferred", Protocol: ProtocolHttp1_1, OkForJson: truePointer},
+		{Name: "post_first.sender_response_before_receiver", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_first.same_path_sender_rejection", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_first.content_type_forwarding", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_first.x_robots_tag_none", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_first.transferred", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_first.reuse_path", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "get_first.content_type_forwarding", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "get_first.x_robots_tag_none", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "get_first.transferred", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "get_first.reuse_path", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "put.sender_response_before_receiver", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "put.same_path_sender_rejection", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "put.content_type_forwarding", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "put.x_robots_tag_none", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "put.transferred", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "put.reuse_path", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_cancel_post", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "get_cancel_get", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "service_worker_registration_rejection", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_first_byte_by_byte_streaming.transferred", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "multipart_form_data.content_type_forwarding", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "multipart_form_data.content_disposition_forwarding", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "multipart_form_data.transferred", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "h2_rst_stream", Protocol: ProtocolHttp1_1, Status: ResultStatusSkipped, SkipReason: "http1.1 is not supported"},
+		{Name: "alt_svc", Protocol: ProtocolHttp1_1, Status: ResultStatusSkipped, SkipReason: "http1.1 is not supported"},
+		{Name: "keep_alive_and_pipelining.keep_alive", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "keep_alive_and_pipelining.pipelining", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "slow_headers_isolation", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "simultaneous_request", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_first_chunked_long_transfer.partial_transfer", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_first_chunked_long_transfer.partial_transfer", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_first_chunked_long_transfer.partial_transfer", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
+		{Name: "post_first_chunked_long_transfer.transferred", Protocol: ProtocolHttp1_1, Status: ResultStatusOk, OkForJson: truePointer},
 	}
 	assert.Equal(t, expected, results)
 }
@@ -225,8 +672,6 @@ func TestRunChecksForH3(t *testing.T) {
 	})
 	assert.ElementsMatch(t, warningResultNames, []string{
 		"get_first",
-		"post_first.same_path_sender_rejection",
-		"put.same_path_sender_rejection",
 		"get_cancel_get",
 		"get_cancel_get",
 	})
@@ -13,9 +13,24 @@ import (
 	"time"
 )
 
+var sendFirstSubCheckNames = []string{
+	SubCheckNameSenderResponseBeforeReceiver,
+	SubCheckNameSamePathSenderRejection,
+	SubCheckNameContentTypeForwarding,
+	SubCheckNameXRobotsTagNone,
+	SubCheckNameTransferred,
+	SubCheckNameReusePath,
+	SubCheckNameProtocol,
+}
+
 func post_first() Check {
 	return Check{
-		Name: getCheckName(),
+		Name:          getCheckName(),
+		Description:   "Transfer with the sender's POST request first",
+		SubCheckNames: sendFirstSubCheckNames,
+		Protocols:     AllProtocols(),
+		Tags:          []string{TagBasic},
+		timeout:       sendFirstTimeout,
 		run: func(config *Config, reporter RunCheckReporter) {
 			sendFirstRun("POST", config, reporter)
 		},
@@ -24,24 +39,34 @@ func post_first() Check {
 
 func put() Check {
 	return Check{
-		Name: getCheckName(),
+		Name:          getCheckName(),
+		Description:   "Transfer with the sender's PUT request first",
+		SubCheckNames: sendFirstSubCheckNames,
+		Protocols:     AllProtocols(),
+		Tags:          []string{TagBasic},
+		timeout:       sendFirstTimeout,
 		run: func(config *Config, reporter RunCheckReporter) {
 			sendFirstRun("PUT", config, reporter)
 		},
 	}
 }
 
+func sendFirstTimeout(config *Config) time.Duration {
+	// Transfer and transfer for reuse path
+	return config.SenderResponseBeforeReceiverTimeout + 2*config.FixedLengthBodyGetTimeout + checkTimeoutMargin
+}
+
 func sendFirstRun(sendMethod string, config *Config, reporter RunCheckReporter) {
 	defer reporter.Close()
-	serverUrl, ok, stopServerIfNeed := prepareServerUrl(config, &reporter)
+	serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
 	if !ok {
 		return
 	}
 	defer stopServerIfNeed()
 
-	postHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+	postHttpClient := NewCheckHTTPClient(config)
 	defer postHttpClient.CloseIdleConnections()
-	getHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+	getHttpClient := NewCheckHTTPClient(config)
 	defer getHttpClient.CloseIdleConnections()
 	path := "/" + uuid.NewString()
 	bodyString := "my message"
@@ -61,7 +86,7 @@ func sendFirstRun(sendMethod string, config *Config, reporter RunCheckReporter)
 		}
 		ensureContentLengthExits(postReq)
 		postReq.Header.Set("Content-Type", contentType)
-		postResp, postOk := sendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
+		postResp, postOk := SendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
 		if !postOk {
 			return
 		}
@@ -72,7 +97,7 @@ func sendFirstRun(sendMethod string, config *Config, reporter RunCheckReporter)
 		} else {
 			reporter.Report(RunCheckResult{SubCheckName: SubCheckNameSenderResponseBeforeReceiver})
 			if config.Protocol == ProtocolH3 {
-				reporter.Report(RunCheckResult{SubCheckName: SubCheckNameSamePathSenderRejection, Warnings: []ResultWarning{NewWarning("not supported in h3", nil)}})
+				reporter.Report(RunCheckResult{SubCheckName: SubCheckNameSamePathSenderRejection, SkipReason: "not supported in h3"})
 			} else {
 				ctx, cancel := context.WithCancel(context.Background())
 				go func() { <-gettingCh; cancel() }()
@@ -101,10 +126,11 @@ func sendFirstRun(sendMethod string, config *Config, reporter RunCheckReporter)
 			getWroteRequestNotForH3 = true
 		},
 	}))
+	getReq, getTimer := traceTransfer(getReq)
 	getRespOneshot := oneshot.NewOneshot[*http.Response]()
 	go func() {
 		defer getRespOneshot.Done()
-		getResp, getOk := sendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+		getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
 		if !getOk {
 			return
 		}
@@ -114,6 +140,7 @@ func sendFirstRun(sendMethod string, config *Config, reporter RunCheckReporter)
 	if !ok {
 		return
 	}
+	getTimer.countBody(getResp)
 	checkContentTypeForwarding(getResp, contentType, reporter)
 	checkXRobotsTag(getResp, reporter)
 	bodyBytes, err := io.ReadAll(getResp.Body)
@@ -136,14 +163,14 @@ func sendFirstRun(sendMethod string, config *Config, reporter RunCheckReporter)
 	if ok := checkSenderRespReadUp(SubCheckNameTransferred, postResp, reporter); !ok {
 		return
 	}
-	reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred})
+	reporter.Report(RunCheckResult{SubCheckName: SubCheckNameTransferred, Transfer: getTimer.timing()})
 
 	checkTransferForReusePath(config, url, reporter)
 	return
 }
 
 func checkSenderConnected(ctx context.Context, config *Config, sendMethod string, url string, reporter RunCheckReporter) {
-	sendHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+	sendHttpClient := NewCheckHTTPClient(config)
 	defer sendHttpClient.CloseIdleConnections()
 	var bodyReader io.Reader
 	if config.Protocol == ProtocolHttp1_0 || config.Protocol == ProtocolHttp1_0_tls {
@@ -0,0 +1,88 @@
+package check
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const serverLogTailSize = 2048
+
+type ServerLogTail struct {
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+}
+
+// serverLogs captures stdout and stderr of a server run. They are written into files if the log directory is specified.
+type serverLogs struct {
+	// empty string means no file
+	stdoutPath string
+	stderrPath string
+	stdout     io.Writer
+	stderr     io.Writer
+	stdoutTail *tailBuffer
+	stderrTail *tailBuffer
+	files      []*os.File
+}
+
+func newServerLogs(logDir string /* empty string is OK */, serverRunId string) (*serverLogs, error) {
+	logs := &serverLogs{stdoutTail: newTailBuffer(serverLogTailSize), stderrTail: newTailBuffer(serverLogTailSize)}
+	logs.stdout = logs.stdoutTail
+	logs.stderr = logs.stderrTail
+	if logDir == "" {
+		return logs, nil
+	}
+	logs.stdoutPath = filepath.Join(logDir, serverRunId+".stdout.log")
+	logs.stderrPath = filepath.Join(logDir, serverRunId+".stderr.log")
+	stdoutFile, err := os.Create(logs.stdoutPath)
+	if err != nil {
+		return nil, err
+	}
+	stderrFile, err := os.Create(logs.stderrPath)
+	if err != nil {
+		stdoutFile.Close()
+		return nil, err
+	}
+	logs.files = []*os.File{stdoutFile, stderrFile}
+	logs.stdout = io.MultiWriter(stdoutFile, logs.stdoutTail)
+	logs.stderr = io.MultiWriter(stderrFile, logs.stderrTail)
+	return logs, nil
+}
+
+func (l *serverLogs) tail() *ServerLogTail {
+	return &ServerLogTail{Stdout: l.stdoutTail.String(), Stderr: l.stderrTail.String()}
+}
+
+func (l *serverLogs) close() {
+	for _, file := range l.files {
+		file.Close()
+	}
+}
+
+// tailBuffer keeps the last bytes written
+type tailBuffer struct {
+	mu   sync.Mutex
+	buf  []byte
+	size int
+}
+
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{size: size}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.size {
+		b.buf = append([]byte(nil), b.buf[len(b.buf)-b.size:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
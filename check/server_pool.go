@@ -0,0 +1,121 @@
+package check
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// a server is started in each check. Some checks start more than one.
+	ServerLifecyclePerCheck = "per-check"
+	// a server is shared by checks of the same protocol
+	ServerLifecyclePerProtocol = "per-protocol"
+	// a server is shared by all checks
+	ServerLifecyclePerRun = "per-run"
+)
+
+func AllServerLifecycles() []string {
+	return []string{ServerLifecyclePerCheck, ServerLifecyclePerProtocol, ServerLifecyclePerRun}
+}
+
+func serverLifecycleShared(lifecycle string) bool {
+	return lifecycle == ServerLifecyclePerProtocol || lifecycle == ServerLifecyclePerRun
+}
+
+// sharedServerPool starts servers on demand and restarts them if exited
+type sharedServerPool struct {
+	mu sync.Mutex
+	// key: protocol or empty string for ServerLifecyclePerRun
+	servers map[Protocol]*sharedServer
+}
+
+type sharedServer struct {
+	// closed when the server is ready or failed to be ready
+	done          chan struct{}
+	server        *startedServer
+	readyDuration time.Duration
+	resultErrors  []ResultError
+}
+
+func newSharedServerPool() *sharedServerPool {
+	return &sharedServerPool{servers: make(map[Protocol]*sharedServer)}
+}
+
+// get returns a ready server. Checks waiting for the same server share the start-up.
+func (p *sharedServerPool) get(config *Config) *sharedServer {
+	var key Protocol
+	if config.ServerLifecycle == ServerLifecyclePerProtocol {
+		key = config.Protocol
+	}
+	p.mu.Lock()
+	s, ok := p.servers[key]
+	if ok && !s.reusable() {
+		ok = false
+	}
+	if !ok {
+		s = &sharedServer{done: make(chan struct{})}
+		p.servers[key] = s
+		go func() {
+			defer close(s.done)
+			s.server, s.resultErrors = startServerRun(config, generateServerRunId())
+			if len(s.resultErrors) != 0 {
+				return
+			}
+			s.readyDuration, s.resultErrors = s.server.waitReady(config)
+		}()
+	}
+	p.mu.Unlock()
+	<-s.done
+	return s
+}
+
+// reusable returns false if the server failed to start or exited
+func (s *sharedServer) reusable() bool {
+	select {
+	case <-s.done:
+	default:
+		// starting
+		return true
+	}
+	if len(s.resultErrors) != 0 {
+		return false
+	}
+	select {
+	case <-s.server.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *sharedServerPool) stopAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.servers {
+		<-s.done
+		if s.server != nil {
+			s.server.signal(syscall.SIGTERM)
+		}
+	}
+}
+
+// crashError is not nil if the server exited after the check started at checkStartTime.
+// An exit before it is charged to earlier checks.
+func (s *sharedServer) crashError(checkStartTime time.Time) *ResultError {
+	select {
+	case <-s.server.exited:
+	default:
+		return nil
+	}
+	if s.server.exitedAt.Before(checkStartTime) {
+		return nil
+	}
+	message := fmt.Sprintf("shared server %s exited during the check", s.server.id)
+	if s.server.exitErr != nil {
+		message += fmt.Sprintf(": %+v", s.server.exitErr)
+	}
+	resultError := NewError(fmt.Sprintf("%s, stderr: %s", message, s.server.logs.stderrTail.String()), nil)
+	return &resultError
+}
@@ -0,0 +1,266 @@
+package check
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// ServerResourceUsage is the sum of the processes in the process group of a server
+type ServerResourceUsage struct {
+	RssBytes   int64   `json:"rss_bytes"`
+	CpuSeconds float64 `json:"cpu_seconds"`
+	Threads    int     `json:"threads"`
+	Fds        int     `json:"fds"`
+}
+
+// ServerResources is usage during a check. A check on a shared server (--server-lifecycle per-protocol or per-run) is not charged for usage before the check starts.
+type ServerResources struct {
+	Peak  ServerResourceUsage `json:"peak"`
+	Final ServerResourceUsage `json:"final"`
+}
+
+// ServerResourceThreshold is the maximum usage of a server. 0 means no threshold.
+type ServerResourceThreshold struct {
+	RssBytes   int64   `yaml:"rss_bytes"`
+	CpuSeconds float64 `yaml:"cpu_seconds"`
+	Threads    int     `yaml:"threads"`
+	Fds        int     `yaml:"fds"`
+}
+
+// exceeded returns descriptions of the usages over the threshold
+func (t *ServerResourceThreshold) exceeded(usage *ServerResourceUsage) []string {
+	var descriptions []string
+	if t.RssBytes != 0 && usage.RssBytes > t.RssBytes {
+		descriptions = append(descriptions, fmt.Sprintf("RSS %d bytes > %d bytes", usage.RssBytes, t.RssBytes))
+	}
+	if t.CpuSeconds != 0 && usage.CpuSeconds > t.CpuSeconds {
+		descriptions = append(descriptions, fmt.Sprintf("CPU time %.2fs > %.2fs", usage.CpuSeconds, t.CpuSeconds))
+	}
+	if t.Threads != 0 && usage.Threads > t.Threads {
+		descriptions = append(descriptions, fmt.Sprintf("threads %d > %d", usage.Threads, t.Threads))
+	}
+	if t.Fds != 0 && usage.Fds > t.Fds {
+		descriptions = append(descriptions, fmt.Sprintf("open FDs %d > %d", usage.Fds, t.Fds))
+	}
+	return descriptions
+}
+
+// addServerResourceProblems adds errors and warnings if the peak usage exceeds the thresholds in config
+func addServerResourceProblems(config *Config, resources *ServerResources, result *Result) {
+	for _, description := range config.ServerResourceErrorThreshold.exceeded(&resources.Peak) {
+		result.Errors = append(result.Errors, NewError("server resource usage exceeded: "+description, nil))
+	}
+	for _, description := range config.ServerResourceWarningThreshold.exceeded(&resources.Peak) {
+		result.Warnings = append(result.Warnings, NewWarning("server resource usage exceeded: "+description, nil))
+	}
+}
+
+// Sampling interval when a threshold is set without Config.ServerResourceSampleInterval
+const defaultServerResourceSampleInterval = 500 * time.Millisecond
+
+// serverResourceSampleInterval returns 0 if sampling is off. Sampling is opt-in because it reads /proc of all processes periodically.
+func serverResourceSampleInterval(config *Config) time.Duration {
+	if config.ServerResourceSampleInterval != 0 {
+		return config.ServerResourceSampleInterval
+	}
+	if config.ServerResourceWarningThreshold != (ServerResourceThreshold{}) || config.ServerResourceErrorThreshold != (ServerResourceThreshold{}) {
+		return defaultServerResourceSampleInterval
+	}
+	return 0
+}
+
+// serverResourceMonitor samples resource usage of a process group from /proc periodically (Linux only)
+type serverResourceMonitor struct {
+	pgid    int
+	mu      sync.Mutex
+	sampled bool
+	last    ServerResourceUsage
+	// the whole lifetime of the server
+	lifetime *serverResourceWindow
+	windows  []*serverResourceWindow
+	stopped  bool
+	stopCh   chan struct{}
+}
+
+// serverResourceWindow is usage of a server from the start of the window such as a check on a shared server
+type serverResourceWindow struct {
+	monitor *serverResourceMonitor
+	// CPU time is cumulative, so CPU time before the window is subtracted
+	baseCpuSeconds float64
+	sampled        bool
+	peak           ServerResourceUsage
+}
+
+func startServerResourceMonitor(pgid int, interval time.Duration) *serverResourceMonitor {
+	m := &serverResourceMonitor{pgid: pgid, stopCh: make(chan struct{})}
+	m.lifetime = &serverResourceWindow{monitor: m}
+	m.windows = []*serverResourceWindow{m.lifetime}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			m.sample()
+			select {
+			case <-ticker.C:
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+	return m
+}
+
+// stop should be called before the process group is gone to keep the last usage
+func (m *serverResourceMonitor) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		return
+	}
+	m.stopped = true
+	close(m.stopCh)
+}
+
+// newWindow starts a window from the current usage. The window should be closed when it is no longer used.
+func (m *serverResourceMonitor) newWindow() *serverResourceWindow {
+	m.sample()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w := &serverResourceWindow{monitor: m}
+	if m.sampled {
+		w.baseCpuSeconds = m.last.CpuSeconds
+		w.add(m.last)
+	}
+	m.windows = append(m.windows, w)
+	return w
+}
+
+func (m *serverResourceMonitor) sample() {
+	m.mu.Lock()
+	stopped := m.stopped
+	m.mu.Unlock()
+	if stopped {
+		return
+	}
+	usage, ok := processGroupResourceUsage(m.pgid)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The process group may have exited while sampling
+	if m.stopped {
+		return
+	}
+	m.sampled = true
+	m.last = usage
+	for _, w := range m.windows {
+		w.add(usage)
+	}
+}
+
+// add should be called with the lock of the monitor
+func (w *serverResourceWindow) add(usage ServerResourceUsage) {
+	w.sampled = true
+	w.peak.RssBytes = max(w.peak.RssBytes, usage.RssBytes)
+	w.peak.CpuSeconds = max(w.peak.CpuSeconds, usage.CpuSeconds-w.baseCpuSeconds)
+	w.peak.Threads = max(w.peak.Threads, usage.Threads)
+	w.peak.Fds = max(w.peak.Fds, usage.Fds)
+}
+
+// resources samples once more if running and returns nil if never sampled in the window (e.g. no /proc)
+func (w *serverResourceWindow) resources() *ServerResources {
+	m := w.monitor
+	m.sample()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !w.sampled {
+		return nil
+	}
+	final := m.last
+	final.CpuSeconds -= w.baseCpuSeconds
+	return &ServerResources{Peak: w.peak, Final: final}
+}
+
+// close stops updating the window
+func (w *serverResourceWindow) close() {
+	m := w.monitor
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.windows = slices.DeleteFunc(m.windows, func(window *serverResourceWindow) bool { return window == w })
+}
+
+// AT_CLKTCK in /proc/self/auxv is USER_HZ, the unit of CPU time in /proc/<pid>/stat
+const auxvClockTicks = 17
+
+// procClockTicksPerSecond is read from the auxiliary vector because sysconf(_SC_CLK_TCK) needs cgo. 100 is the usual value.
+var procClockTicksPerSecond = sync.OnceValue(func() float64 {
+	auxv, err := os.ReadFile("/proc/self/auxv")
+	if err != nil {
+		return 100
+	}
+	// The vector is pairs of native words
+	wordSize := int(unsafe.Sizeof(uintptr(0)))
+	word := func(b []byte) uint64 {
+		if wordSize == 4 {
+			return uint64(binary.NativeEndian.Uint32(b))
+		}
+		return binary.NativeEndian.Uint64(b)
+	}
+	for i := 0; i+2*wordSize <= len(auxv); i += 2 * wordSize {
+		if word(auxv[i:]) == auxvClockTicks {
+			if ticks := word(auxv[i+wordSize:]); ticks != 0 {
+				return float64(ticks)
+			}
+		}
+	}
+	return 100
+})
+
+// processGroupResourceUsage returns false if no process is found. Only Linux is supported because /proc is read.
+func processGroupResourceUsage(pgid int) (usage ServerResourceUsage, ok bool) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		procDir := filepath.Join("/proc", entry.Name())
+		statBytes, err := os.ReadFile(filepath.Join(procDir, "stat"))
+		if err != nil {
+			continue
+		}
+		// "<pid> (<comm>) <state> <ppid> <pgrp> ..."; comm may contain spaces and parentheses
+		stat := string(statBytes)
+		fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+		// fields[0] is the 3rd field in proc(5)
+		if len(fields) < 22 || fields[2] != strconv.Itoa(pgid) {
+			continue
+		}
+		// Exiting processes have no memory and FDs
+		if fields[0] == "Z" || fields[0] == "X" {
+			continue
+		}
+		utime, _ := strconv.ParseInt(fields[11], 10, 64)
+		stime, _ := strconv.ParseInt(fields[12], 10, 64)
+		threads, _ := strconv.Atoi(fields[17])
+		rssPages, _ := strconv.ParseInt(fields[21], 10, 64)
+		fdEntries, _ := os.ReadDir(filepath.Join(procDir, "fd"))
+		ok = true
+		usage.CpuSeconds += float64(utime+stime) / procClockTicksPerSecond()
+		usage.Threads += threads
+		usage.RssBytes += rssPages * int64(os.Getpagesize())
+		usage.Fds += len(fdEntries)
+	}
+	return
+}
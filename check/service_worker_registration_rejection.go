@@ -10,16 +10,23 @@ import (
 
 func service_worker_registration_rejection() Check {
 	return Check{
-		Name: getCheckName(),
+		Name:          getCheckName(),
+		Description:   "Service Worker registration is rejected",
+		SubCheckNames: []string{SubCheckNameProtocol},
+		Protocols:     AllProtocols(),
+		Tags:          []string{TagSecurity},
+		timeout: func(config *Config) time.Duration {
+			return config.ServiceWorkerRejectionTimeout + checkTimeoutMargin
+		},
 		run: func(config *Config, reporter RunCheckReporter) {
 			defer reporter.Close()
-			serverUrl, ok, stopServerIfNeed := prepareServerUrl(config, &reporter)
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
 			if !ok {
 				return
 			}
 			defer stopServerIfNeed()
 
-			getHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+			getHttpClient := NewCheckHTTPClient(config)
 			getHttpClient.Timeout = 1 * time.Second
 			defer getHttpClient.CloseIdleConnections()
 			path := "/" + uuid.NewString()
@@ -39,7 +46,7 @@ func service_worker_registration_rejection() Check {
 					reporter.Report(NewRunCheckResultWithOneError(NewError("failed to GET", err)))
 					return
 				}
-				if resultErrors := checkProtocol(getResp, config.Protocol); len(resultErrors) != 0 {
+				if resultErrors := CheckProtocol(getResp, config.Protocol); len(resultErrors) != 0 {
 					reporter.Report(RunCheckResult{SubCheckName: SubCheckNameProtocol, Errors: resultErrors})
 				}
 				if !(400 <= getResp.StatusCode && getResp.StatusCode < 500) {
@@ -7,11 +7,20 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
 func simultaneous_request() Check {
 	return Check{
-		Name: getCheckName(),
+		Name:          getCheckName(),
+		Description:   "Transfer with a sender and a receiver requesting simultaneously",
+		SubCheckNames: []string{SubCheckNameProtocol},
+		Protocols:     AllProtocols(),
+		Tags:          []string{TagLong},
+		timeout: func(config *Config) time.Duration {
+			// A server runs for each request
+			return time.Duration(config.NSimultaneousRequests) * (config.FixedLengthBodyGetTimeout + checkTimeoutMargin)
+		},
 		run: func(config *Config, reporter RunCheckReporter) {
 			defer reporter.Close()
 
@@ -32,14 +41,14 @@ func simultaneous_request() Check {
 }
 
 func transferForSimultaneousRequest(config *Config, reporter RunCheckReporter) bool {
-	serverUrl, ok, stopServerIfNeed := prepareServerUrl(config, &reporter)
+	serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
 	if !ok {
 		return false
 	}
 	defer stopServerIfNeed()
-	getHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+	getHttpClient := NewCheckHTTPClient(config)
 	defer getHttpClient.CloseIdleConnections()
-	postHttpClient := newHTTPClient(config.Protocol, config.TlsSkipVerifyCert)
+	postHttpClient := NewCheckHTTPClient(config)
 	defer postHttpClient.CloseIdleConnections()
 
 	url := serverUrl + "/" + uuid.NewString()
@@ -60,7 +69,7 @@ func transferForSimultaneousRequest(config *Config, reporter RunCheckReporter) b
 
 	go func() {
 		defer getRespOneshot.Done()
-		getResp, getOk := sendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+		getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
 		if !getOk {
 			return
 		}
@@ -68,7 +77,7 @@ func transferForSimultaneousRequest(config *Config, reporter RunCheckReporter) b
 	}()
 	go func() {
 		defer postRespOneshot.Done()
-		postResp, postOk := sendOrGetAndCheck(getHttpClient, postReq, config.Protocol, reporter)
+		postResp, postOk := SendOrGetAndCheck(getHttpClient, postReq, config.Protocol, reporter)
 		if !postOk {
 			return
 		}
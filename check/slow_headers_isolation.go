@@ -0,0 +1,154 @@
+package check
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/nwtgck/piping-server-check/oneshot"
+	"github.com/nwtgck/piping-server-check/util"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const nSlowHeadersConnections = 4
+
+func slow_headers_isolation() Check {
+	return Check{
+		Name:          getCheckName(),
+		Description:   "Clients sending headers slowly do not block other transfers",
+		SubCheckNames: []string{SubCheckNameProtocol},
+		// Slow headers are raw HTTP/1.1 requests
+		Protocols: []Protocol{ProtocolHttp1_1, ProtocolHttp1_1_tls},
+		Tags:      []string{TagConnection},
+		timeout: func(config *Config) time.Duration {
+			// One second is for the first byte of slow headers
+			return 1*time.Second + config.FixedLengthBodyGetTimeout + checkTimeoutMargin
+		},
+		run: func(config *Config, reporter RunCheckReporter) {
+			defer reporter.Close()
+			serverUrl, ok, stopServerIfNeed := PrepareServerUrl(config, &reporter)
+			if !ok {
+				return
+			}
+			defer stopServerIfNeed()
+
+			parsedUrl, err := url.Parse(serverUrl)
+			if err != nil {
+				reporter.Report(NewRunCheckResultWithOneError(NewError("failed to parse server URL", err)))
+				return
+			}
+			// Long enough not to finish headers during the transfer
+			slowHeader := fmt.Sprintf("GET /%s HTTP/1.1\r\nHost: %s\r\nX-Slow-Header: %s\r\n\r\n", uuid.NewString(), parsedUrl.Host, strings.Repeat("a", 1024))
+
+			startedWg := new(sync.WaitGroup)
+			finishCh := make(chan struct{})
+			defer close(finishCh)
+			for i := 0; i < nSlowHeadersConnections; i++ {
+				conn, err := dialRawHttp1_1Conn(config, serverUrl)
+				if err != nil {
+					reporter.Report(NewRunCheckResultWithOneError(NewError("failed to connect for slow headers", err)))
+					return
+				}
+				defer conn.Close()
+				startedWg.Add(1)
+				go func() {
+					var startedOnce sync.Once
+					defer startedOnce.Do(startedWg.Done)
+					var buff [1]byte
+					slowReader := util.NewRateLimitReader(strings.NewReader(slowHeader), 1)
+					for {
+						select {
+						case <-finishCh:
+							return
+						default:
+						}
+						n, err := slowReader.Read(buff[:])
+						if err != nil {
+							return
+						}
+						if _, err := conn.Write(buff[:n]); err != nil {
+							return
+						}
+						startedOnce.Do(startedWg.Done)
+					}
+				}()
+			}
+			// Wait for the first bytes of all slow headers
+			startedWg.Wait()
+
+			if ok := transferForSlowHeadersIsolation(config, serverUrl+"/"+uuid.NewString(), reporter); !ok {
+				return
+			}
+			reporter.Report(RunCheckResult{Message: fmt.Sprintf("transferred while %d connections are sending headers slowly", nSlowHeadersConnections)})
+			return
+		},
+	}
+}
+
+func transferForSlowHeadersIsolation(config *Config, url string, reporter RunCheckReporter) bool {
+	getHttpClient := NewCheckHTTPClient(config)
+	defer getHttpClient.CloseIdleConnections()
+	postHttpClient := NewCheckHTTPClient(config)
+	defer postHttpClient.CloseIdleConnections()
+
+	bodyString := "my message"
+
+	getRespOneshot := oneshot.NewOneshot[*http.Response]()
+	go func() {
+		defer getRespOneshot.Done()
+		getReq, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			reporter.Report(RunCheckResult{Errors: []ResultError{NewError("failed to create GET request", err)}})
+			return
+		}
+		getResp, getOk := SendOrGetAndCheck(getHttpClient, getReq, config.Protocol, reporter)
+		if !getOk {
+			return
+		}
+		getRespOneshot.Send(getResp)
+	}()
+
+	postRespOneshot := oneshot.NewOneshot[*http.Response]()
+	go func() {
+		defer postRespOneshot.Done()
+		postReq, err := http.NewRequest("POST", url, strings.NewReader(bodyString))
+		if err != nil {
+			reporter.Report(RunCheckResult{Errors: []ResultError{NewError("failed to create POST request", err)}})
+			return
+		}
+		postResp, postOk := SendOrGetAndCheck(postHttpClient, postReq, config.Protocol, reporter)
+		if !postOk {
+			return
+		}
+		postRespOneshot.Send(postResp)
+	}()
+
+	getResp, ok := respWithTimeout("", "GET", getRespOneshot, config.FixedLengthBodyGetTimeout, reporter)
+	if !ok {
+		return false
+	}
+	bodyBytes, err := io.ReadAll(getResp.Body)
+	if err != nil {
+		reporter.Report(RunCheckResult{Errors: []ResultError{NewError("failed to read up", err)}})
+		return false
+	}
+	if ok := checkCloseReceiverRespBody(getResp, reporter); !ok {
+		return false
+	}
+	if string(bodyBytes) != bodyString {
+		reporter.Report(RunCheckResult{Errors: []ResultError{NewError("message different", nil)}})
+		return false
+	}
+	// TODO: POST-timeout (already GET)
+	postResp, ok := <-postRespOneshot.Channel()
+	if !ok {
+		return false
+	}
+	if ok := checkSenderRespReadUp("", postResp, reporter); !ok {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package check
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+type TransferTiming struct {
+	// from the receiver's request to the first byte of its response. 0 if httptrace is not supported (HTTP/1.0 and HTTP/3).
+	TtfbMs float64 `json:"ttfb_ms,omitempty"`
+	// body bytes read by the receiver
+	Bytes int64 `json:"bytes"`
+	// from the first byte (or the request if no TTFB) to the end of the body
+	BytesPerSec float64 `json:"bytes_per_sec"`
+}
+
+// transferTimer measures the receiver's side of a transfer
+type transferTimer struct {
+	mu        sync.Mutex
+	start     time.Time
+	firstByte time.Time
+	lastRead  time.Time
+	bytes     int64
+}
+
+// traceTransfer returns the request with httptrace and a timer started now
+func traceTransfer(req *http.Request) (*http.Request, *transferTimer) {
+	t := &transferTimer{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.firstByte = time.Now()
+		},
+	}))
+	return req, t
+}
+
+// countBody replaces resp.Body to count bytes read
+func (t *transferTimer) countBody(resp *http.Response) {
+	resp.Body = &transferTimerBody{ReadCloser: resp.Body, timer: t}
+}
+
+type transferTimerBody struct {
+	io.ReadCloser
+	timer *transferTimer
+}
+
+func (b *transferTimerBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.timer.mu.Lock()
+	defer b.timer.mu.Unlock()
+	b.timer.bytes += int64(n)
+	b.timer.lastRead = time.Now()
+	return n, err
+}
+
+func (t *transferTimer) timing() *TransferTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timing := &TransferTiming{Bytes: t.bytes}
+	bodyStart := t.start
+	if !t.firstByte.IsZero() {
+		timing.TtfbMs = durationMs(t.firstByte.Sub(t.start))
+		bodyStart = t.firstByte
+	}
+	if d := t.lastRead.Sub(bodyStart); t.bytes != 0 && d > 0 {
+		timing.BytesPerSec = float64(t.bytes) / d.Seconds()
+	}
+	return timing
+}
@@ -0,0 +1,118 @@
+package h2c_upgrade_round_tripper
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/net/http2"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// ENABLE_PUSH=0 as a SETTINGS frame payload
+var http2SettingsPayload = []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x00}
+
+// H2cUpgradeRoundTripper upgrades a cleartext HTTP/1.1 connection to HTTP/2 by "Upgrade: h2c" (RFC 7540 Section 3.2)
+// The upgrade request is OPTIONS to the path of the first request and its response is discarded.
+type H2cUpgradeRoundTripper struct {
+	mu         sync.Mutex
+	clientConn *http2.ClientConn
+}
+
+func (rt *H2cUpgradeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	clientConn, err := rt.getClientConn(req)
+	if err != nil {
+		return nil, err
+	}
+	return clientConn.RoundTrip(req)
+}
+
+func (rt *H2cUpgradeRoundTripper) getClientConn(req *http.Request) (*http2.ClientConn, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.clientConn != nil && rt.clientConn.CanTakeNewRequest() {
+		return rt.clientConn, nil
+	}
+	clientConn, err := upgrade(req)
+	if err != nil {
+		return nil, err
+	}
+	rt.clientConn = clientConn
+	return clientConn, nil
+}
+
+// dialAddress returns host:port of u. The port defaults to 80 because only http scheme is supported.
+func dialAddress(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+func upgrade(req *http.Request) (*http2.ClientConn, error) {
+	if req.URL.Scheme != "http" {
+		return nil, fmt.Errorf("h2c upgrade requires http scheme but %s", req.URL.Scheme)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(req.Context(), "tcp", dialAddress(req.URL))
+	if err != nil {
+		return nil, err
+	}
+	upgradedConn, err := UpgradeConn(conn, req.URL.Host, req.URL.RequestURI())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// AllowHTTP makes the stream ID start with 3 because 1 is used by the upgrade request
+	transport := &http2.Transport{AllowHTTP: true}
+	clientConn, err := transport.NewClientConn(upgradedConn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return clientConn, nil
+}
+
+// UpgradeConn upgrades conn to HTTP/2 by OPTIONS to requestURI. The client connection preface is not sent.
+// The returned connection should be used instead of conn because frames may be buffered while reading the 101 response.
+// Stream ID 1 is used by the upgrade request, and its response is left to the caller.
+func UpgradeConn(conn net.Conn, host string, requestURI string) (net.Conn, error) {
+	if _, err := fmt.Fprintf(conn, "OPTIONS %s HTTP/1.1\r\n", requestURI); err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(conn, "Host: %s\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: %s\r\n\r\n", host, base64.RawURLEncoding.EncodeToString(http2SettingsPayload)); err != nil {
+		return nil, err
+	}
+	bufReader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(bufReader, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("expected status=%d for h2c upgrade but status=%d found", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	return &bufferedConn{Conn: conn, reader: bufReader}, nil
+}
+
+func (rt *H2cUpgradeRoundTripper) CloseIdleConnections() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.clientConn != nil {
+		rt.clientConn.Close()
+		rt.clientConn = nil
+	}
+}
+
+// bufferedConn reads frames which were already buffered while reading the 101 response
+type bufferedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
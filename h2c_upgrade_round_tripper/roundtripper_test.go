@@ -0,0 +1,95 @@
+package h2c_upgrade_round_tripper
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func runServer1() (port string, close func()) {
+	server := http.Server{
+		Handler: h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "server message (%s)", r.Proto)
+		}), &http2.Server{}),
+	}
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		panic(err)
+	}
+	_, port, _ = net.SplitHostPort(listener.Addr().String())
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			if errors.Is(err, http.ErrServerClosed) {
+				return
+			}
+			panic(err)
+		}
+	}()
+	close = func() {
+		if err := server.Close(); err != nil {
+			panic(err)
+		}
+	}
+	return
+}
+
+func TestPost(t *testing.T) {
+	port, closeServer := runServer1()
+	defer closeServer()
+	client := &http.Client{
+		Transport: &H2cUpgradeRoundTripper{},
+	}
+	defer client.CloseIdleConnections()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(fmt.Sprintf("http://127.0.0.1:%s", port), "application/octet-stream", strings.NewReader("my body"))
+		assert.NoError(t, err)
+		assert.Equal(t, "HTTP/2.0", resp.Proto)
+		bodyBytes, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "server message (HTTP/2.0)", string(bodyBytes))
+	}
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	// Server without h2c support
+	server := http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "server message")
+		}),
+	}
+	listener, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	go server.Serve(listener)
+	defer server.Close()
+	client := &http.Client{
+		Transport: &H2cUpgradeRoundTripper{},
+	}
+	_, err = client.Get(fmt.Sprintf("http://127.0.0.1:%s", port))
+	assert.ErrorContains(t, err, "expected status=101")
+}
+
+func TestDialAddress(t *testing.T) {
+	for _, tc := range []struct {
+		url      string
+		expected string
+	}{
+		{url: "http://example.com/path", expected: "example.com:80"},
+		{url: "http://example.com:8080/path", expected: "example.com:8080"},
+		{url: "http://127.0.0.1", expected: "127.0.0.1:80"},
+		{url: "http://[::1]/", expected: "[::1]:80"},
+		{url: "http://[::1]:8181/", expected: "[::1]:8181"},
+	} {
+		u, err := url.Parse(tc.url)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, dialAddress(u), tc.url)
+	}
+}
@@ -36,7 +36,13 @@ func (rt Http10RoundTripper) RoundTrip(req *http.Request) (*http.Response, error
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
+	// The connection is closed when the response body is closed
+	responded := false
+	defer func() {
+		if !responded {
+			conn.Close()
+		}
+	}()
 
 	if _, err = fmt.Fprintf(conn, "%s %s HTTP/1.0\r\n", req.Method, req.URL.RequestURI()); err != nil {
 		return nil, err
@@ -88,5 +94,18 @@ func (rt Http10RoundTripper) RoundTrip(req *http.Request) (*http.Response, error
 		return nil, err
 	}
 	resp.TLS = tlsConnectionState
+	resp.Body = &connClosingBody{ReadCloser: resp.Body, conn: conn}
+	responded = true
 	return resp, nil
 }
+
+type connClosingBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b *connClosingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.conn.Close()
+	return err
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/nwtgck/piping-server-check/check"
+	"github.com/nwtgck/piping-server-check/version"
+	"github.com/spf13/cobra"
+	"os"
+	"runtime"
+	"time"
+)
+
+var benchFlag struct {
+	BodySize      string
+	Concurrency   int
+	Duration      time.Duration
+	Chunked       bool
+	BaselinePath  string
+	MaxRegression float64
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+	benchCmd.Flags().StringVarP(&benchFlag.BodySize, "body-size", "", "1MiB", "Body size of each transfer (e.g. 100, 64KiB, 1GiB)")
+	// Shadows --concurrency of checks
+	benchCmd.Flags().IntVarP(&benchFlag.Concurrency, "concurrency", "", 1, "The number of simultaneous transfers")
+	benchCmd.Flags().DurationVarP(&benchFlag.Duration, "duration", "", 10*time.Second, "Duration to repeat transfers on each protocol")
+	benchCmd.Flags().BoolVarP(&benchFlag.Chunked, "chunked", "", false, "Send chunked bodies instead of fixed-length bodies")
+	benchCmd.Flags().StringVarP(&benchFlag.BaselinePath, "baseline", "", "", "Bench report JSON to compare with. Regressions exit with non-zero")
+	benchCmd.Flags().Float64VarP(&benchFlag.MaxRegression, "max-regression", "", 0.1, "Allowed ratio of throughput decrease and latency increase, and allowed increase of error rate, against --baseline")
+}
+
+// benchReport is the output of the bench subcommand and the input of --baseline
+type benchReport struct {
+	Version string              `json:"version"`
+	Engine  string              `json:"engine"`
+	Os      string              `json:"os"`
+	Arch    string              `json:"arch"`
+	Results []check.BenchResult `json:"results"`
+	// --baseline only
+	Comparisons []benchComparison `json:"comparisons,omitempty"`
+}
+
+type benchComparison struct {
+	Server   string         `json:"server,omitempty"`
+	Protocol check.Protocol `json:"protocol"`
+	Metric   string         `json:"metric"`
+	Baseline float64        `json:"baseline"`
+	Current  float64        `json:"current"`
+	// ratio of the difference to the baseline, or the difference for error_rate
+	Change    float64 `json:"change"`
+	Regressed bool    `json:"regressed"`
+}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Benchmark throughput and latency of transfers and print a JSON report",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if os.Getenv("GITHUB_ACTIONS") == "true" {
+			color.NoColor = false
+		}
+		commonConfig, err := loadCommonConfig(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+		overrideIfFlagChanged(cmd, "tls-skip-verify", &commonConfig.TlsSkipVerifyCert, flag.TlsSkipVerify)
+		overrideIfFlagChanged(cmd, "get-response-received-timeout", &commonConfig.GetResponseReceivedTimeout, flag.GetResponseReceivedTimeout)
+		overrideIfFlagChanged(cmd, "server-log-dir", &commonConfig.ServerLogDir, flag.ServerLogDir)
+		if commonConfig.ServerLogDir != "" {
+			if err := os.MkdirAll(commonConfig.ServerLogDir, 0755); err != nil {
+				return err
+			}
+		}
+		bodySize, err := parseByteSize(benchFlag.BodySize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --body-size: %+v\n", err)
+			os.Exit(1)
+		}
+		if benchFlag.Concurrency < 1 {
+			fmt.Fprintf(os.Stderr, "--concurrency should be 1 or more\n")
+			os.Exit(1)
+		}
+		if benchFlag.Duration <= 0 {
+			fmt.Fprintf(os.Stderr, "--duration should be positive\n")
+			os.Exit(1)
+		}
+		workload := check.BenchWorkload{BodySize: bodySize, Concurrency: benchFlag.Concurrency, Duration: benchFlag.Duration, Chunked: benchFlag.Chunked}
+		var baseline *benchReport
+		if benchFlag.BaselinePath != "" {
+			if baseline, err = readBenchReport(benchFlag.BaselinePath); err != nil {
+				fmt.Fprintf(os.Stderr, "%+v\n", err)
+				os.Exit(1)
+			}
+		}
+		protocols := selectedProtocols()
+		if len(protocols) == 0 {
+			fmt.Fprintf(os.Stderr, "Specify --http1.1, --http1.1-tls or other protocols to bench\n")
+			os.Exit(1)
+		}
+		serverConfigs, err := serverConfigsByFlag(&commonConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+
+		report := benchReport{
+			Version: version.Version,
+			Engine:  runtime.Version(),
+			Os:      runtime.GOOS,
+			Arch:    runtime.GOARCH,
+		}
+		shouldExitWithNonZero := false
+		for _, serverConfig := range serverConfigs {
+			for _, protocol := range protocols {
+				config := serverConfig
+				config.Protocol = protocol
+				result := check.RunBench(&config, workload)
+				// The report goes to stdout, so the progress goes to stderr
+				printBenchResult(&result)
+				// No successful transfers
+				if result.Transfers == result.Failures {
+					shouldExitWithNonZero = true
+				}
+				report.Results = append(report.Results, result)
+			}
+		}
+		if baseline != nil {
+			report.Comparisons = compareBenchReports(baseline, &report, benchFlag.MaxRegression)
+			for _, comparison := range report.Comparisons {
+				if comparison.Regressed {
+					shouldExitWithNonZero = true
+					fmt.Fprintln(os.Stderr, color.RedString("✖︎ regressed: %s", benchComparisonLine(&comparison)))
+				}
+			}
+		}
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonBytes))
+		if shouldExitWithNonZero {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+// benchResultName is "<protocol>" or "<server>/<protocol>"
+func benchResultName(server string, protocol check.Protocol) string {
+	if server == "" {
+		return string(protocol)
+	}
+	return server + "/" + string(protocol)
+}
+
+func printBenchResult(result *check.BenchResult) {
+	line := fmt.Sprintf("%s: %d transfers, error rate: %.3f, latency p50: %.1fms, p90: %.1fms, p99: %.1fms, %.1f KiB/s",
+		benchResultName(result.Server, result.Protocol), result.Transfers, result.ErrorRate, result.LatencyMs.P50, result.LatencyMs.P90, result.LatencyMs.P99, result.BytesPerSec/1024)
+	switch {
+	case result.Transfers == 0 || result.Failures == result.Transfers:
+		fmt.Fprintln(os.Stderr, color.RedString("✖︎ %s", line))
+	case result.Failures != 0:
+		fmt.Fprintln(os.Stderr, color.YellowString("⚠︎ %s", line))
+	default:
+		fmt.Fprintln(os.Stderr, color.GreenString("✔︎ %s", line))
+	}
+	for _, resultError := range result.Errors {
+		fmt.Fprintf(os.Stderr, "  %s\n", resultError.Message)
+	}
+}
+
+func readBenchReport(path string) (*benchReport, error) {
+	reportBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report benchReport
+	if err := json.Unmarshal(reportBytes, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// compareBenchReports compares results of the same server and protocol. Results without successful transfers are not compared.
+func compareBenchReports(baseline *benchReport, current *benchReport, maxRegression float64) []benchComparison {
+	var comparisons []benchComparison
+	for _, currentResult := range current.Results {
+		var baselineResult *check.BenchResult
+		for i := range baseline.Results {
+			if baseline.Results[i].Server == currentResult.Server && baseline.Results[i].Protocol == currentResult.Protocol {
+				baselineResult = &baseline.Results[i]
+			}
+		}
+		if baselineResult == nil || baselineResult.Transfers == baselineResult.Failures || currentResult.Transfers == 0 {
+			continue
+		}
+		if baselineResult.Workload != currentResult.Workload {
+			fmt.Fprintln(os.Stderr, color.YellowString("⚠︎ workload of %s differs from the baseline", benchResultName(currentResult.Server, currentResult.Protocol)))
+		}
+		newComparison := func(metric string, baselineValue float64, currentValue float64) benchComparison {
+			return benchComparison{Server: currentResult.Server, Protocol: currentResult.Protocol, Metric: metric, Baseline: baselineValue, Current: currentValue}
+		}
+		// Latencies are of successful transfers only
+		if currentResult.Transfers != currentResult.Failures {
+			// higher is worse
+			for _, c := range []benchComparison{
+				newComparison("latency_ms.p50", baselineResult.LatencyMs.P50, currentResult.LatencyMs.P50),
+				newComparison("latency_ms.p90", baselineResult.LatencyMs.P90, currentResult.LatencyMs.P90),
+				newComparison("latency_ms.p99", baselineResult.LatencyMs.P99, currentResult.LatencyMs.P99),
+			} {
+				c.Change = relativeChange(c.Baseline, c.Current)
+				c.Regressed = c.Change > maxRegression
+				comparisons = append(comparisons, c)
+			}
+		}
+		// lower is worse
+		c := newComparison("bytes_per_sec", baselineResult.BytesPerSec, currentResult.BytesPerSec)
+		c.Change = relativeChange(c.Baseline, c.Current)
+		c.Regressed = c.Change < -maxRegression
+		comparisons = append(comparisons, c)
+		// The baseline is often 0, so the difference is used
+		c = newComparison("error_rate", baselineResult.ErrorRate, currentResult.ErrorRate)
+		c.Change = c.Current - c.Baseline
+		c.Regressed = c.Change > maxRegression
+		comparisons = append(comparisons, c)
+	}
+	return comparisons
+}
+
+// relativeChange returns 0 if baseline is 0 because infinity is not in JSON
+func relativeChange(baseline float64, current float64) float64 {
+	if baseline == 0 {
+		return 0
+	}
+	return (current - baseline) / baseline
+}
+
+func benchComparisonLine(comparison *benchComparison) string {
+	return fmt.Sprintf("%s %s: %g → %g (%+.3f)", benchResultName(comparison.Server, comparison.Protocol), comparison.Metric, comparison.Baseline, comparison.Current, comparison.Change)
+}
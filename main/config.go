@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nwtgck/piping-server-check/check"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultConfigProfileName = "default"
+
+func defaultConfigProfile() check.Config {
+	return check.Config{
+		HealthCheckPath:                                  "/",
+		ReservedPath:                                     "/version",
+		Concurrency:                                      1,
+		SenderResponseBeforeReceiverTimeout:              5 * time.Second,
+		FirstByteCheckTimeout:                            5 * time.Second,
+		GetResponseReceivedTimeout:                       5 * time.Second,
+		GetReqWroteRequestWaitForH3:                      3 * time.Second,
+		TransferBytePerSec:                               1024 * 1024,
+		WaitDurationAfterSenderCancel:                    1 * time.Second,
+		WaitDurationBetweenReceiverWroteRequestAndCancel: 3 * time.Second,
+		WaitDurationAfterReceiverCancel:                  3 * time.Second,
+		FixedLengthBodyGetTimeout:                        6 * time.Second,
+		ServiceWorkerRejectionTimeout:                    3 * time.Second,
+		NSimultaneousRequests:                            10,
+		ReadinessTimeout:                                 30 * time.Second,
+		ReadinessStrategy:                                check.ReadinessStrategyHealthCheck,
+		HealthCheckMethod:                                "GET",
+		ServerLifecycle:                                  check.ServerLifecyclePerCheck,
+		ExternalCheckTimeout:                             30 * time.Second,
+		HarMaxBodySize:                                   64 * 1024,
+	}
+}
+
+var configProfiles = map[string]func() check.Config{
+	defaultConfigProfileName: defaultConfigProfile,
+	// For local servers on CI runners
+	"ci-fast": func() check.Config {
+		config := defaultConfigProfile()
+		config.SenderResponseBeforeReceiverTimeout = 1 * time.Second
+		config.FirstByteCheckTimeout = 1 * time.Second
+		config.GetResponseReceivedTimeout = 1 * time.Second
+		config.GetReqWroteRequestWaitForH3 = 1 * time.Second
+		config.WaitDurationBetweenReceiverWroteRequestAndCancel = 2 * time.Second
+		config.WaitDurationAfterReceiverCancel = 1 * time.Second
+		config.FixedLengthBodyGetTimeout = 3 * time.Second
+		config.ServiceWorkerRejectionTimeout = 1 * time.Second
+		return config
+	},
+	// For public servers and slow CI runners
+	"slow-network": func() check.Config {
+		config := defaultConfigProfile()
+		config.SenderResponseBeforeReceiverTimeout = 15 * time.Second
+		config.FirstByteCheckTimeout = 15 * time.Second
+		config.GetResponseReceivedTimeout = 15 * time.Second
+		config.GetReqWroteRequestWaitForH3 = 6 * time.Second
+		config.WaitDurationAfterSenderCancel = 3 * time.Second
+		config.WaitDurationBetweenReceiverWroteRequestAndCancel = 6 * time.Second
+		config.WaitDurationAfterReceiverCancel = 6 * time.Second
+		config.FixedLengthBodyGetTimeout = 20 * time.Second
+		config.ServiceWorkerRejectionTimeout = 10 * time.Second
+		config.ReadinessTimeout = 60 * time.Second
+		return config
+	},
+}
+
+func configProfileNames() []string {
+	names := maps.Keys(configProfiles)
+	slices.Sort(names)
+	return names
+}
+
+// loadConfig returns the profile overridden by the config file (YAML or JSON) if the path is not empty, and the resolved profile name.
+// The file can specify the base profile by "profile" field.
+func loadConfig(profileName string, profileSpecified bool, configPath string /* empty string is OK */) (check.Config, string, error) {
+	var fileBytes []byte
+	if configPath != "" {
+		var err error
+		fileBytes, err = os.ReadFile(configPath)
+		if err != nil {
+			return check.Config{}, "", err
+		}
+		var profileInFile struct {
+			Profile string `yaml:"profile"`
+		}
+		if err := yaml.Unmarshal(fileBytes, &profileInFile); err != nil {
+			return check.Config{}, "", fmt.Errorf("failed to parse %s: %w", configPath, err)
+		}
+		if !profileSpecified && profileInFile.Profile != "" {
+			profileName = profileInFile.Profile
+		}
+	}
+	newProfile, ok := configProfiles[profileName]
+	if !ok {
+		return check.Config{}, "", fmt.Errorf("unknown profile '%s' (available: %v)", profileName, configProfileNames())
+	}
+	config := newProfile()
+	if configPath != "" {
+		configInFile := struct {
+			Profile      string `yaml:"profile"`
+			check.Config `yaml:",inline"`
+		}{Config: config}
+		decoder := yaml.NewDecoder(bytes.NewReader(fileBytes))
+		// Typos in keys should not be ignored silently
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&configInFile); err != nil && err != io.EOF {
+			return check.Config{}, "", fmt.Errorf("failed to parse %s: %w", configPath, err)
+		}
+		config = configInFile.Config
+	}
+	if err := validateConcurrency(&config); err != nil {
+		return check.Config{}, "", err
+	}
+	return config, profileName, nil
+}
+
+func validateConcurrency(config *check.Config) error {
+	if config.Concurrency < 1 {
+		return fmt.Errorf("concurrency should be >= 1 but %d", config.Concurrency)
+	}
+	return nil
+}
+
+func validateReadiness(config *check.Config) error {
+	if config.ReadinessStrategy != "" && !slices.Contains(check.AllReadinessStrategies(), config.ReadinessStrategy) {
+		return fmt.Errorf("unknown readiness strategy '%s' (available: %v)", config.ReadinessStrategy, check.AllReadinessStrategies())
+	}
+	if config.ReadinessStrategy == check.ReadinessStrategyLog {
+		if config.ReadinessLogRegex == "" {
+			return fmt.Errorf("specify --readiness-log-regex for --readiness-strategy=%s", check.ReadinessStrategyLog)
+		}
+		if _, err := regexp.Compile(config.ReadinessLogRegex); err != nil {
+			return fmt.Errorf("invalid --readiness-log-regex: %w", err)
+		}
+	}
+	return nil
+}
+
+var byteSizeUnits = map[string]int64{"": 1, "B": 1, "KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30}
+
+// parseByteSize parses "512MiB", "1GiB" or "100"
+func parseByteSize(s string) (int64, error) {
+	numberEnd := strings.IndexFunc(s, func(r rune) bool { return r < '0' || '9' < r })
+	if numberEnd == -1 {
+		numberEnd = len(s)
+	}
+	unit, ok := byteSizeUnits[s[numberEnd:]]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit of '%s' (available: B, KiB, MiB, GiB)", s)
+	}
+	n, err := strconv.ParseInt(s[:numberEnd], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * unit, nil
+}
+
+// parseServerResourceThreshold parses "rss=512MiB,cpu=30s,threads=100,fds=1000". Omitted keys mean no threshold.
+func parseServerResourceThreshold(s string) (check.ServerResourceThreshold, error) {
+	var threshold check.ServerResourceThreshold
+	for _, item := range strings.Split(s, ",") {
+		if item == "" {
+			continue
+		}
+		key, value, found := strings.Cut(item, "=")
+		if !found {
+			return threshold, fmt.Errorf("'%s' should be <key>=<value>", item)
+		}
+		var err error
+		switch key {
+		case "rss":
+			threshold.RssBytes, err = parseByteSize(value)
+		case "cpu":
+			var d time.Duration
+			d, err = time.ParseDuration(value)
+			threshold.CpuSeconds = d.Seconds()
+		case "threads":
+			threshold.Threads, err = strconv.Atoi(value)
+		case "fds":
+			threshold.Fds, err = strconv.Atoi(value)
+		default:
+			return threshold, fmt.Errorf("unknown key '%s' (available: rss, cpu, threads, fds)", key)
+		}
+		if err != nil {
+			return threshold, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return threshold, nil
+}
+
+// configForJson converts durations into human-readable strings such as "5s"
+func configForJson(config *check.Config) (map[string]any, error) {
+	yamlBytes, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(yamlBytes, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"github.com/nwtgck/piping-server-check/check"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadConfigProfiles(t *testing.T) {
+	for _, profileName := range configProfileNames() {
+		config, resolvedProfileName, err := loadConfig(profileName, true, "")
+		assert.NoError(t, err, profileName)
+		assert.Equal(t, profileName, resolvedProfileName)
+		assert.Equal(t, configProfiles[profileName](), config)
+		assert.NoError(t, validateConcurrency(&config), profileName)
+	}
+	config, _, err := loadConfig("ci-fast", true, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1*time.Second, config.FirstByteCheckTimeout)
+	_, _, err = loadConfig("no-such-profile", true, "")
+	assert.EqualError(t, err, "unknown profile 'no-such-profile' (available: [ci-fast default slow-network])")
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		fileName         string
+		content          string
+		profileName      string
+		profileSpecified bool
+		expectedProfile  string
+		expected         func() check.Config
+		expectedError    string
+	}{
+		{
+			name:            "yaml",
+			fileName:        "config.yaml",
+			content:         "fixed_length_body_get_timeout: 30s\nn_simultaneous_requests: 20\n",
+			profileName:     defaultConfigProfileName,
+			expectedProfile: defaultConfigProfileName,
+			expected: func() check.Config {
+				config := defaultConfigProfile()
+				config.FixedLengthBodyGetTimeout = 30 * time.Second
+				config.NSimultaneousRequests = 20
+				return config
+			},
+		},
+		{
+			name:            "json",
+			fileName:        "config.json",
+			content:         `{"concurrency": 4, "reserved_path": "/help"}`,
+			profileName:     defaultConfigProfileName,
+			expectedProfile: defaultConfigProfileName,
+			expected: func() check.Config {
+				config := defaultConfigProfile()
+				config.Concurrency = 4
+				config.ReservedPath = "/help"
+				return config
+			},
+		},
+		{
+			name:            "empty file",
+			fileName:        "config.yaml",
+			content:         "",
+			profileName:     defaultConfigProfileName,
+			expectedProfile: defaultConfigProfileName,
+			expected:        defaultConfigProfile,
+		},
+		{
+			name:            "profile in file",
+			fileName:        "config.yaml",
+			content:         "profile: slow-network\nfirst_byte_check_timeout: 2s\n",
+			profileName:     defaultConfigProfileName,
+			expectedProfile: "slow-network",
+			expected: func() check.Config {
+				config := configProfiles["slow-network"]()
+				config.FirstByteCheckTimeout = 2 * time.Second
+				return config
+			},
+		},
+		{
+			name:             "profile by option over profile in file",
+			fileName:         "config.yaml",
+			content:          "profile: slow-network\nfirst_byte_check_timeout: 2s\n",
+			profileName:      "ci-fast",
+			profileSpecified: true,
+			expectedProfile:  "ci-fast",
+			expected: func() check.Config {
+				config := configProfiles["ci-fast"]()
+				config.FirstByteCheckTimeout = 2 * time.Second
+				return config
+			},
+		},
+		{
+			name:          "unknown key",
+			fileName:      "config.yaml",
+			content:       "fixed_length_body_get_timout: 30s\n",
+			profileName:   defaultConfigProfileName,
+			expectedError: "field fixed_length_body_get_timout not found",
+		},
+		{
+			name:          "unknown profile in file",
+			fileName:      "config.yaml",
+			content:       "profile: no-such-profile\n",
+			profileName:   defaultConfigProfileName,
+			expectedError: "unknown profile 'no-such-profile'",
+		},
+		{
+			name:          "zero concurrency",
+			fileName:      "config.yaml",
+			content:       "concurrency: 0\n",
+			profileName:   defaultConfigProfileName,
+			expectedError: "concurrency should be >= 1 but 0",
+		},
+		{
+			name:          "invalid duration",
+			fileName:      "config.yaml",
+			content:       "first_byte_check_timeout: soon\n",
+			profileName:   defaultConfigProfileName,
+			expectedError: "failed to parse",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := writeConfigFile(t, tc.fileName, tc.content)
+			config, profileName, err := loadConfig(tc.profileName, tc.profileSpecified, configPath)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedProfile, profileName)
+			assert.Equal(t, tc.expected(), config)
+		})
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	configPath := writeConfigFile(t, "config.yaml", "profile: ci-fast\nconcurrency: 2\nfirst_byte_check_timeout: 2s\n")
+	cmd := &cobra.Command{}
+	var concurrency uint
+	var firstByteCheckTimeout time.Duration
+	cmd.Flags().UintVar(&concurrency, "concurrency", 1, "")
+	cmd.Flags().DurationVar(&firstByteCheckTimeout, "first-byte-check-timeout", 5*time.Second, "")
+	assert.NoError(t, cmd.ParseFlags([]string{"--concurrency", "3"}))
+	config, _, err := loadConfig(defaultConfigProfileName, false, configPath)
+	assert.NoError(t, err)
+	overrideIfFlagChanged(cmd, "concurrency", &config.Concurrency, concurrency)
+	overrideIfFlagChanged(cmd, "first-byte-check-timeout", &config.FirstByteCheckTimeout, firstByteCheckTimeout)
+	// option > file
+	assert.Equal(t, uint(3), config.Concurrency)
+	// file > profile
+	assert.Equal(t, 2*time.Second, config.FirstByteCheckTimeout)
+	// profile > default
+	assert.Equal(t, configProfiles["ci-fast"]().GetResponseReceivedTimeout, config.GetResponseReceivedTimeout)
+}
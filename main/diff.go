@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/nwtgck/piping-server-check/check"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <old JSONL> <new JSONL>",
+	Short: "Compare two result JSONL files and exit with non-zero on regressions",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if os.Getenv("GITHUB_ACTIONS") == "true" {
+			color.NoColor = false
+		}
+		oldJsonl, err := readResultJsonl(args[0])
+		if err != nil {
+			return err
+		}
+		newJsonl, err := readResultJsonl(args[1])
+		if err != nil {
+			return err
+		}
+		for _, x := range []struct {
+			label string
+			jsonl *resultJsonl
+		}{{"old", oldJsonl}, {"new", newJsonl}} {
+			optionsJsonBytes, err := json.Marshal(x.jsonl.header.Options)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: version %s, options: %s\n", x.label, x.jsonl.header.Version, string(optionsJsonBytes))
+		}
+
+		diff := diffResultJsonl(oldJsonl, newJsonl)
+		if len(diff.newlyFailing)+len(diff.newlyPassing)+len(diff.newWarnings)+len(diff.appeared)+len(diff.disappeared) == 0 {
+			fmt.Println("no differences")
+		}
+		printDiffSection(color.RedString("✖︎ newly failing"), diff.newlyFailing)
+		printDiffSection(color.GreenString("✔︎ newly passing"), diff.newlyPassing)
+		printDiffSection(color.YellowString("⚠︎ new warnings or flaky"), diff.newWarnings)
+		printDiffSection(color.CyanString("+ appeared"), diff.appeared)
+		printDiffSection(color.CyanString("- disappeared"), diff.disappeared)
+		if diff.regressed {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+// resultDiff has lines of results in each section
+type resultDiff struct {
+	newlyFailing []string
+	newlyPassing []string
+	newWarnings  []string
+	appeared     []string
+	disappeared  []string
+	// true if a result newly fails, an appeared result fails or a result which was ok disappears
+	regressed bool
+}
+
+func diffResultJsonl(oldJsonl *resultJsonl, newJsonl *resultJsonl) resultDiff {
+	var diff resultDiff
+	for _, key := range newJsonl.keys {
+		newResult := newJsonl.results[key]
+		oldResult, ok := oldJsonl.results[key]
+		if !ok {
+			line := fmt.Sprintf("%s (%s)", key, newResult.Status)
+			if newResult.Status == check.ResultStatusError {
+				diff.regressed = true
+				line += resultMessagesForDiff(newResult)
+			}
+			diff.appeared = append(diff.appeared, line)
+			continue
+		}
+		line := fmt.Sprintf("%s: %s → %s", key, oldResult.Status, newResult.Status)
+		switch {
+		case newResult.Status == check.ResultStatusError && oldResult.Status != check.ResultStatusError:
+			diff.regressed = true
+			diff.newlyFailing = append(diff.newlyFailing, line+resultMessagesForDiff(newResult))
+		case oldResult.Status == check.ResultStatusError && newResult.Status != check.ResultStatusError:
+			diff.newlyPassing = append(diff.newlyPassing, line)
+		case (newResult.Status == check.ResultStatusWarning || newResult.Status == check.ResultStatusFlaky) && oldResult.Status != newResult.Status:
+			diff.newWarnings = append(diff.newWarnings, line+resultMessagesForDiff(newResult))
+		}
+	}
+	for _, key := range oldJsonl.keys {
+		if _, ok := newJsonl.results[key]; !ok {
+			oldResult := oldJsonl.results[key]
+			if oldResult.Status == check.ResultStatusOk {
+				diff.regressed = true
+			}
+			diff.disappeared = append(diff.disappeared, fmt.Sprintf("%s (%s)", key, oldResult.Status))
+		}
+	}
+	return diff
+}
+
+func resultMessagesForDiff(result check.Result) string {
+	var messages []string
+	for _, resultError := range result.Errors {
+		messages = append(messages, resultError.Message)
+	}
+	for _, warning := range result.Warnings {
+		messages = append(messages, warning.Message)
+	}
+	if len(messages) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", strings.Join(messages, "; "))
+}
+
+func printDiffSection(title string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Printf("%s (%d)\n", title, len(lines))
+	for _, line := range lines {
+		fmt.Printf("  %s\n", line)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/nwtgck/piping-server-check/check"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newResultJsonl(results ...check.Result) *resultJsonl {
+	r := &resultJsonl{results: make(map[string]check.Result)}
+	for _, result := range results {
+		r.add(result)
+	}
+	return r
+}
+
+func TestDiffResultJsonl(t *testing.T) {
+	okResult := func(name string) check.Result {
+		return check.Result{Name: name, Protocol: check.ProtocolHttp1_1, Status: check.ResultStatusOk}
+	}
+	errorResult := func(name string) check.Result {
+		return check.Result{Name: name, Protocol: check.ProtocolHttp1_1, Status: check.ResultStatusError, Errors: []check.ResultError{check.NewError("error on purpose", nil)}}
+	}
+
+	t.Run("no differences", func(t *testing.T) {
+		diff := diffResultJsonl(newResultJsonl(okResult("a"), errorResult("b")), newResultJsonl(okResult("a"), errorResult("b")))
+		assert.Equal(t, resultDiff{}, diff)
+	})
+
+	t.Run("newly failing", func(t *testing.T) {
+		diff := diffResultJsonl(newResultJsonl(okResult("a")), newResultJsonl(errorResult("a")))
+		assert.Equal(t, []string{"http1.1/a: ok → error (error on purpose)"}, diff.newlyFailing)
+		assert.True(t, diff.regressed)
+	})
+
+	t.Run("newly passing", func(t *testing.T) {
+		diff := diffResultJsonl(newResultJsonl(errorResult("a")), newResultJsonl(okResult("a")))
+		assert.Equal(t, []string{"http1.1/a: error → ok"}, diff.newlyPassing)
+		assert.False(t, diff.regressed)
+	})
+
+	t.Run("appeared", func(t *testing.T) {
+		diff := diffResultJsonl(newResultJsonl(), newResultJsonl(okResult("a")))
+		assert.Equal(t, []string{"http1.1/a (ok)"}, diff.appeared)
+		assert.False(t, diff.regressed)
+
+		diff = diffResultJsonl(newResultJsonl(), newResultJsonl(errorResult("a")))
+		assert.Equal(t, []string{"http1.1/a (error) (error on purpose)"}, diff.appeared)
+		assert.True(t, diff.regressed)
+	})
+
+	t.Run("disappeared", func(t *testing.T) {
+		diff := diffResultJsonl(newResultJsonl(errorResult("a")), newResultJsonl())
+		assert.Equal(t, []string{"http1.1/a (error)"}, diff.disappeared)
+		assert.False(t, diff.regressed)
+
+		diff = diffResultJsonl(newResultJsonl(okResult("a")), newResultJsonl())
+		assert.Equal(t, []string{"http1.1/a (ok)"}, diff.disappeared)
+		assert.True(t, diff.regressed)
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nwtgck/piping-server-check/check"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"time"
+)
+
+const expectationExpiresLayout = "2006-01-02"
+
+// expectation is an entry of --expectations file
+type expectation struct {
+	// "<result name>" or "<protocol>/<result name>"
+	Name   string             `yaml:"name" json:"name"`
+	Status check.ResultStatus `yaml:"status" json:"status"`
+	Reason string             `yaml:"reason" json:"reason"`
+	Issue  string             `yaml:"issue,omitempty" json:"issue,omitempty"`
+	// "YYYY-MM-DD". The expectation is ignored after this date.
+	Expires string `yaml:"expires,omitempty" json:"expires,omitempty"`
+
+	protocol   check.Protocol
+	resultName string
+	expired    bool
+	// true if a result matched during the run
+	matched bool
+}
+
+type expectationDeviation struct {
+	Name     string             `json:"name"`
+	Protocol check.Protocol     `json:"protocol"`
+	Expected check.ResultStatus `json:"expected"`
+	Actual   check.ResultStatus `json:"actual,omitempty"`
+	Reason   string             `json:"reason,omitempty"`
+	Issue    string             `json:"issue,omitempty"`
+	// true if no result matched the expectation
+	Unmatched bool `json:"unmatched,omitempty"`
+}
+
+func loadExpectations(checks []check.Check, path string, now time.Time) ([]expectation, error) {
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var expectations []expectation
+	if err := yaml.Unmarshal(fileBytes, &expectations); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	allStatuses := []check.ResultStatus{check.ResultStatusOk, check.ResultStatusWarning, check.ResultStatusError, check.ResultStatusSkipped, check.ResultStatusFlaky}
+	for i := range expectations {
+		e := &expectations[i]
+		if err := validateQualifiedResultName(checks, e.Name); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		// already validated
+		e.protocol, e.resultName, _ = parseProtocolQualified(e.Name)
+		if !slices.Contains(allStatuses, e.Status) {
+			return nil, fmt.Errorf("%s: unknown status '%s' of %s (available: %v)", path, e.Status, e.Name, allStatuses)
+		}
+		if e.Expires != "" {
+			expires, err := time.ParseInLocation(expectationExpiresLayout, e.Expires, now.Location())
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid expires of %s: %w", path, e.Name, err)
+			}
+			// expires at the end of the day
+			e.expired = !now.Before(expires.AddDate(0, 0, 1))
+		}
+	}
+	return expectations, nil
+}
+
+// findExpectation returns nil if not found or expired
+func findExpectation(expectations []expectation, result *check.Result) *expectation {
+	for i := range expectations {
+		e := &expectations[i]
+		if !e.expired && (e.protocol == "" || e.protocol == result.Protocol) && e.resultName == result.Name {
+			return e
+		}
+	}
+	return nil
+}
+
+// findExpectationDeviation returns nil if the result is as expected. A result without expectation is expected to be ok, skipped or flaky.
+func findExpectationDeviation(e *expectation /* nil OK */, result *check.Result, compromise string /* empty string means not compromised */) *expectationDeviation {
+	deviation := expectationDeviation{Name: result.Name, Protocol: result.Protocol, Actual: result.Status}
+	if e == nil {
+		// flaky is not an error
+		if result.Status == check.ResultStatusOk || result.Status == check.ResultStatusSkipped || result.Status == check.ResultStatusFlaky || compromise != "" {
+			return nil
+		}
+		deviation.Expected = check.ResultStatusOk
+		return &deviation
+	}
+	if e.Status == result.Status {
+		return nil
+	}
+	deviation.Expected = e.Status
+	deviation.Reason = e.Reason
+	deviation.Issue = e.Issue
+	return &deviation
+}
+
+// findUnmatchedExpectationDeviations returns deviations of expectations which no result matched although their checks ran
+func findUnmatchedExpectationDeviations(expectations []expectation, targets []check.CheckTarget) []*expectationDeviation {
+	var deviations []*expectationDeviation
+	for _, e := range expectations {
+		if e.expired || e.matched {
+			continue
+		}
+		checkName := strings.SplitN(e.resultName, ".", 2)[0]
+		ran := slices.ContainsFunc(targets, func(target check.CheckTarget) bool {
+			return target.Check.Name == checkName && (e.protocol == "" || e.protocol == target.Protocol)
+		})
+		if !ran {
+			continue
+		}
+		deviations = append(deviations, &expectationDeviation{Name: e.resultName, Protocol: e.protocol, Expected: e.Status, Reason: e.Reason, Issue: e.Issue, Unmatched: true})
+	}
+	return deviations
+}
+
+func writeExpectations(path string, results []check.Result) error {
+	var expectations []expectation
+	var names []string
+	for _, result := range results {
+		if result.Status != check.ResultStatusError && result.Status != check.ResultStatusWarning && result.Status != check.ResultStatusFlaky {
+			continue
+		}
+		name := string(result.Protocol) + "/" + result.Name
+		if slices.Contains(names, name) {
+			continue
+		}
+		names = append(names, name)
+		var reason string
+		if len(result.Errors) != 0 {
+			reason = result.Errors[0].Message
+		} else {
+			reason = result.Warnings[0].Message
+		}
+		expectations = append(expectations, expectation{Name: name, Status: result.Status, Reason: reason})
+	}
+	yamlBytes, err := yaml.Marshal(expectations)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, yamlBytes, 0644)
+}
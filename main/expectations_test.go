@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/nwtgck/piping-server-check/check"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFindUnmatchedExpectationDeviations(t *testing.T) {
+	targets := []check.CheckTarget{
+		{Check: check.Check{Name: "post_first"}, Protocol: check.ProtocolHttp1_1},
+		{Check: check.Check{Name: "get_first"}, Protocol: check.ProtocolHttp1_1},
+	}
+	expectations := []expectation{
+		{Status: check.ResultStatusError, Reason: "matched", resultName: "post_first", matched: true},
+		{Status: check.ResultStatusError, Reason: "renamed sub check", resultName: "post_first.old_name"},
+		{Status: check.ResultStatusError, Reason: "expired", resultName: "get_first.old_name", expired: true},
+		{Status: check.ResultStatusError, Reason: "protocol not run", resultName: "get_first.old_name", protocol: check.ProtocolH2},
+		{Status: check.ResultStatusError, Reason: "check not run", resultName: "put.old_name"},
+		{Status: check.ResultStatusWarning, Reason: "protocol run", resultName: "get_first", protocol: check.ProtocolHttp1_1},
+	}
+	deviations := findUnmatchedExpectationDeviations(expectations, targets)
+	assert.Equal(t, []*expectationDeviation{
+		{Name: "post_first.old_name", Expected: check.ResultStatusError, Reason: "renamed sub check", Unmatched: true},
+		{Name: "get_first", Protocol: check.ProtocolHttp1_1, Expected: check.ResultStatusWarning, Reason: "protocol run", Unmatched: true},
+	}, deviations)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/nwtgck/piping-server-check/check"
+	"io"
+	"os"
+	"sync"
+)
+
+// jsonlHeader is the first record of JSONL
+type jsonlHeader struct {
+	Version string `json:"version"`
+	Engine  string `json:"engine"`
+	Os      string `json:"os"`
+	Arch    string `json:"arch"`
+	Options any    `json:"options"`
+	Config  any    `json:"config"`
+}
+
+// resultSummary is the last record of JSONL
+type resultSummary struct {
+	Ok      int `json:"ok"`
+	Warning int `json:"warning"`
+	Flaky   int `json:"flaky"`
+	// including compromised errors
+	Error int `json:"error"`
+	// errors allowed by --compromise or --expectations
+	Compromised int `json:"compromised"`
+	Skipped     int `json:"skipped"`
+	// --expectations only
+	ExpectationDeviations int `json:"expectation_deviations,omitempty"`
+	ExitStatus            int `json:"exit_status"`
+}
+
+// jsonlWriter writes each record as soon as it arrives not to lose results when a check hangs or CI times out
+type jsonlWriter struct {
+	// nil means no output
+	w         io.Writer
+	closeFile func() error
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// newJsonlWriter opens path. "-" means stdout and empty string means no output.
+func newJsonlWriter(path string) (*jsonlWriter, error) {
+	switch path {
+	case "":
+		return &jsonlWriter{closeFile: func() error { return nil }}, nil
+	case "-":
+		return &jsonlWriter{w: os.Stdout, closeFile: func() error { return nil }}, nil
+	}
+	// *os.File is not buffered, so a written record is in the file even if the process is killed
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	closeFile := func() error {
+		// Records should be on the disk even if the machine such as a CI runner goes down
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+	return &jsonlWriter{w: file, closeFile: closeFile}, nil
+}
+
+func (w *jsonlWriter) write(jsonBytes []byte) error {
+	if w.w == nil {
+		return nil
+	}
+	_, err := w.w.Write(append(jsonBytes, 10))
+	return err
+}
+
+// close can be called more than once and returns the error of the first call
+func (w *jsonlWriter) close() error {
+	w.closeOnce.Do(func() { w.closeErr = w.closeFile() })
+	return w.closeErr
+}
+
+// resultJsonl is a parsed result JSONL file
+type resultJsonl struct {
+	header jsonlHeader
+	// key: "<protocol>/<result name>" or "<server>/<protocol>/<result name>"
+	results map[string]check.Result
+	// keys in order of appearance
+	keys []string
+}
+
+func readResultJsonl(path string) (*resultJsonl, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := &resultJsonl{results: make(map[string]check.Result)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		if _, ok := record["version"]; ok {
+			if err := json.Unmarshal(scanner.Bytes(), &r.header); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		} else if _, ok := record["name"]; ok {
+			var result check.Result
+			if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+			r.add(result)
+		}
+		// unused_compromises and summary are ignored
+	}
+	return r, scanner.Err()
+}
+
+func (r *resultJsonl) add(result check.Result) {
+	if result.Status == "" {
+		// JSONL written before "status" was introduced
+		switch {
+		case len(result.Errors) != 0:
+			result.Status = check.ResultStatusError
+		case len(result.Warnings) != 0:
+			result.Status = check.ResultStatusWarning
+		default:
+			result.Status = check.ResultStatusOk
+		}
+	}
+	key := string(result.Protocol) + "/" + result.Name
+	if result.Server != "" {
+		key = result.Server + "/" + key
+	}
+	existing, ok := r.results[key]
+	if !ok {
+		r.keys = append(r.keys, key)
+	}
+	// The same name can appear multiple times (e.g. partial_transfer). The worst one represents them.
+	if !ok || resultStatusSeverity(result.Status) > resultStatusSeverity(existing.Status) {
+		r.results[key] = result
+	}
+}
+
+func resultStatusSeverity(status check.ResultStatus) int {
+	switch status {
+	case check.ResultStatusError:
+		return 4
+	case check.ResultStatusFlaky:
+		return 3
+	case check.ResultStatusWarning:
+		return 2
+	case check.ResultStatusOk:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/nwtgck/piping-server-check/check"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readLines(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	assert.NoError(t, scanner.Err())
+	return lines
+}
+
+func writeJsonlRecord(t *testing.T, w *jsonlWriter, record any) {
+	jsonBytes, err := json.Marshal(record)
+	assert.NoError(t, err)
+	assert.NoError(t, w.write(jsonBytes))
+}
+
+func TestJsonlWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.jsonl")
+	w, err := newJsonlWriter(path)
+	assert.NoError(t, err)
+	writeJsonlRecord(t, w, &jsonlHeader{Version: "0.0.0"})
+	// Each record is in the file before closing
+	assert.Equal(t, []string{`{"version":"0.0.0","engine":"","os":"","arch":"","options":null,"config":null}`}, readLines(t, path))
+	writeJsonlRecord(t, w, &check.Result{Name: "get_first", Protocol: check.ProtocolHttp1_1, Status: check.ResultStatusError, Errors: []check.ResultError{{Message: "timeout"}}})
+	assert.Len(t, readLines(t, path), 2)
+	writeJsonlRecord(t, w, &struct {
+		Summary resultSummary `json:"summary"`
+	}{Summary: resultSummary{Error: 1, ExitStatus: 1}})
+	assert.NoError(t, w.close())
+	// close can be called again after os.Exit() paths close it explicitly
+	assert.NoError(t, w.close())
+
+	lines := readLines(t, path)
+	assert.Len(t, lines, 3)
+	var summaryRecord struct {
+		Summary resultSummary `json:"summary"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &summaryRecord))
+	assert.Equal(t, resultSummary{Error: 1, ExitStatus: 1}, summaryRecord.Summary)
+	// The summary is not read as a result
+	r, err := readResultJsonl(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0", r.header.Version)
+	assert.Equal(t, []string{"http1.1/get_first"}, r.keys)
+	assert.Equal(t, check.ResultStatusError, r.results["http1.1/get_first"].Status)
+}
+
+func TestJsonlWriterStdout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stdout")
+	stdout, err := os.Create(path)
+	assert.NoError(t, err)
+	originalStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = originalStdout }()
+	w, err := newJsonlWriter("-")
+	assert.NoError(t, err)
+	assert.NoError(t, w.write([]byte(`{"name":"get_first"}`)))
+	assert.NoError(t, w.close())
+	// stdout is not closed by the writer
+	_, err = stdout.Write([]byte("after close\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, stdout.Close())
+	assert.Equal(t, []string{`{"name":"get_first"}`, "after close"}, readLines(t, path))
+}
+
+func TestJsonlWriterNoOutput(t *testing.T) {
+	w, err := newJsonlWriter("")
+	assert.NoError(t, err)
+	assert.NoError(t, w.write([]byte("{}")))
+	assert.NoError(t, w.close())
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/nwtgck/piping-server-check/check"
+	"os"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName    xml.Name          `xml:"testsuites"`
+	Name       string            `xml:"name,attr"`
+	Tests      int               `xml:"tests,attr"`
+	Failures   int               `xml:"failures,attr"`
+	Skipped    int               `xml:"skipped,attr"`
+	Time       string            `xml:"time,attr"`
+	TestSuites []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+	duration  time.Duration
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitReport has one test suite per protocol (per server and protocol for multiple servers) and one test case per result
+type junitReport struct {
+	suites []*junitTestSuite
+	// key: "<suite name>/<check name>"
+	lastDurations map[string]time.Duration
+}
+
+func newJunitReport() *junitReport {
+	return &junitReport{lastDurations: make(map[string]time.Duration)}
+}
+
+// allowedErrorMessage is why the error is allowed such as compromise. Empty string means not allowed.
+func (r *junitReport) add(result *check.Result, allowedErrorMessage string) {
+	suiteName := string(result.Protocol)
+	if result.Server != "" {
+		suiteName = result.Server + "/" + suiteName
+	}
+	var suite *junitTestSuite
+	for _, s := range r.suites {
+		if s.Name == suiteName {
+			suite = s
+		}
+	}
+	if suite == nil {
+		suite = &junitTestSuite{Name: suiteName}
+		r.suites = append(r.suites, suite)
+	}
+	// result.Duration is from the start of the check, so subtract the previous result of the same check
+	checkName, _, _ := strings.Cut(result.Name, ".")
+	key := suiteName + "/" + checkName
+	duration := result.Duration
+	if lastDuration := r.lastDurations[key]; lastDuration <= duration {
+		duration -= lastDuration
+	}
+	r.lastDurations[key] = result.Duration
+
+	testCase := junitTestCase{
+		ClassName: suiteName,
+		Name:      result.Name,
+		Time:      junitSeconds(duration),
+	}
+	var errorMessages []string
+	for _, resultError := range result.Errors {
+		errorMessages = append(errorMessages, resultError.Message)
+	}
+	switch {
+	case result.Status == check.ResultStatusSkipped:
+		testCase.Skipped = &junitSkipped{Message: result.SkipReason}
+		suite.Skipped++
+	case result.Status == check.ResultStatusError && allowedErrorMessage != "":
+		testCase.Skipped = &junitSkipped{Message: fmt.Sprintf("%s: %s", allowedErrorMessage, strings.Join(errorMessages, "; "))}
+		suite.Skipped++
+	case result.Status == check.ResultStatusError:
+		// An external check can report an error status without errors
+		message := "error"
+		if len(errorMessages) != 0 {
+			message = errorMessages[0]
+		}
+		testCase.Failure = &junitFailure{Message: message, Text: strings.Join(errorMessages, "\n")}
+		suite.Failures++
+	}
+	var warningMessages []string
+	for _, warning := range result.Warnings {
+		warningMessages = append(warningMessages, "warning: "+warning.Message)
+	}
+	if result.Status == check.ResultStatusFlaky {
+		warningMessages = append(warningMessages, fmt.Sprintf("flaky: passed %d, failed %d: %s", result.Attempts.Passed, result.Attempts.Failed, strings.Join(errorMessages, "; ")))
+	}
+	testCase.SystemOut = strings.Join(warningMessages, "\n")
+	suite.TestCases = append(suite.TestCases, testCase)
+	suite.Tests++
+	suite.duration += duration
+}
+
+func (r *junitReport) write(path string) error {
+	testSuites := junitTestSuites{Name: "piping-server-check", TestSuites: r.suites}
+	var duration time.Duration
+	for _, suite := range r.suites {
+		suite.Time = junitSeconds(suite.duration)
+		testSuites.Tests += suite.Tests
+		testSuites.Failures += suite.Failures
+		testSuites.Skipped += suite.Skipped
+		duration += suite.duration
+	}
+	testSuites.Time = junitSeconds(duration)
+	xmlBytes, err := xml.MarshalIndent(&testSuites, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(xmlBytes, 10)...), 0644)
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/nwtgck/piping-server-check/check"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readJunitReport(t *testing.T, r *junitReport) junitTestSuites {
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	assert.NoError(t, r.write(path))
+	xmlBytes, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var testSuites junitTestSuites
+	assert.NoError(t, xml.Unmarshal(xmlBytes, &testSuites))
+	return testSuites
+}
+
+func TestJunitReport(t *testing.T) {
+	r := newJunitReport()
+	r.add(&check.Result{Name: "get_first.transferred", Protocol: check.ProtocolHttp1_1, Status: check.ResultStatusOk, Duration: 1 * time.Second}, "")
+	r.add(&check.Result{Name: "get_first", Protocol: check.ProtocolHttp1_1, Status: check.ResultStatusError, Errors: []check.ResultError{{Message: "not transferred"}, {Message: "timeout"}}, Duration: 3 * time.Second}, "")
+	r.add(&check.Result{Name: "post_first", Protocol: check.ProtocolHttp1_1, Status: check.ResultStatusSkipped, SkipReason: "not supported", Duration: 100 * time.Millisecond}, "")
+	r.add(&check.Result{Name: "put", Protocol: check.ProtocolH2c, Status: check.ResultStatusError, Errors: []check.ResultError{{Message: "failed to put"}}, Duration: 500 * time.Millisecond}, "compromised by --compromise put")
+	// An external check can report an error status without errors
+	r.add(&check.Result{Name: "external", Protocol: check.ProtocolH2c, Status: check.ResultStatusError, Duration: 500 * time.Millisecond}, "")
+	r.add(&check.Result{Name: "get_first", Protocol: check.ProtocolH2c, Status: check.ResultStatusFlaky, Errors: []check.ResultError{{Message: "timeout"}}, Warnings: []check.ResultWarning{{Message: "slow"}}, Attempts: &check.ResultAttempts{Passed: 2, Failed: 1}, Duration: 2 * time.Second}, "")
+	r.add(&check.Result{Name: "get_first", Protocol: check.ProtocolHttp1_1, Server: "other", Status: check.ResultStatusOk, Duration: 1 * time.Second}, "")
+	testSuites := readJunitReport(t, r)
+
+	assert.Equal(t, "piping-server-check", testSuites.Name)
+	assert.Equal(t, 7, testSuites.Tests)
+	assert.Equal(t, 2, testSuites.Failures)
+	assert.Equal(t, 2, testSuites.Skipped)
+	assert.Equal(t, "7.100", testSuites.Time)
+	assert.Len(t, testSuites.TestSuites, 3)
+
+	http1_1 := testSuites.TestSuites[0]
+	assert.Equal(t, "http1.1", http1_1.Name)
+	assert.Equal(t, 3, http1_1.Tests)
+	assert.Equal(t, 1, http1_1.Failures)
+	assert.Equal(t, 1, http1_1.Skipped)
+	// Durations of results of the same check are subtracted
+	assert.Equal(t, "3.100", http1_1.Time)
+	assert.Equal(t, "1.000", http1_1.TestCases[0].Time)
+	assert.Equal(t, "2.000", http1_1.TestCases[1].Time)
+	assert.Equal(t, &junitFailure{Message: "not transferred", Text: "not transferred\ntimeout"}, http1_1.TestCases[1].Failure)
+	assert.Equal(t, &junitSkipped{Message: "not supported"}, http1_1.TestCases[2].Skipped)
+
+	h2c := testSuites.TestSuites[1]
+	assert.Equal(t, "h2c", h2c.Name)
+	assert.Equal(t, 3, h2c.Tests)
+	assert.Equal(t, 1, h2c.Failures)
+	assert.Equal(t, 1, h2c.Skipped)
+	assert.Equal(t, &junitSkipped{Message: "compromised by --compromise put: failed to put"}, h2c.TestCases[0].Skipped)
+	assert.Nil(t, h2c.TestCases[0].Failure)
+	assert.Equal(t, &junitFailure{Message: "error"}, h2c.TestCases[1].Failure)
+	assert.Nil(t, h2c.TestCases[2].Failure)
+	assert.Equal(t, "warning: slow\nflaky: passed 2, failed 1: timeout", h2c.TestCases[2].SystemOut)
+
+	other := testSuites.TestSuites[2]
+	assert.Equal(t, "other/http1.1", other.Name)
+	assert.Equal(t, "other/http1.1", other.TestCases[0].ClassName)
+	// Not subtracted by the result of another server
+	assert.Equal(t, "1.000", other.TestCases[0].Time)
+}
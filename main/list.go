@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nwtgck/piping-server-check/check"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var listFlag struct {
+	Json bool
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().BoolVarP(&listFlag.Json, "json", "", false, "Print checks as JSON")
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List checks",
+	RunE: func(_ *cobra.Command, args []string) error {
+		checks, err := allChecks(flag.ExternalChecks)
+		if err != nil {
+			return err
+		}
+		if listFlag.Json {
+			jsonBytes, err := json.MarshalIndent(checks, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(jsonBytes))
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTAGS\tPROTOCOLS\tSUBCHECKS\tDESCRIPTION")
+		for _, c := range checks {
+			var protocols []string
+			for _, protocol := range c.Protocols {
+				protocols = append(protocols, string(protocol))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Name, strings.Join(c.Tags, ","), strings.Join(protocols, ","), strings.Join(c.SubCheckNames, ","), c.Description)
+		}
+		return w.Flush()
+	},
+}
+
+// compromise is "<result name>" or "<protocol>/<result name>"
+func validateCompromises(checks []check.Check, compromises []string) error {
+	for _, compromise := range compromises {
+		if err := validateQualifiedResultName(checks, compromise); err != nil {
+			return fmt.Errorf("--compromise: %w", err)
+		}
+	}
+	return nil
+}
+
+// qualifiedResultName is "<result name>" or "<protocol>/<result name>"
+func validateQualifiedResultName(checks []check.Check, qualifiedResultName string) error {
+	_, resultName, err := parseProtocolQualified(qualifiedResultName)
+	if err != nil {
+		return err
+	}
+	checkName, subCheckName, hasSubCheck := strings.Cut(resultName, ".")
+	c := findCheck(checks, checkName)
+	if c == nil {
+		return fmt.Errorf("unknown check '%s' in %s. See `%s list`", checkName, qualifiedResultName, os.Args[0])
+	}
+	if hasSubCheck && !slices.Contains(c.Tags, check.TagExternal) && !slices.Contains(c.SubCheckNames, subCheckName) {
+		return fmt.Errorf("unknown subcheck '%s' of %s in %s. See `%s list`", subCheckName, checkName, qualifiedResultName, os.Args[0])
+	}
+	return nil
+}
+
+// allChecks returns built-in checks and external checks by --external-check
+func allChecks(externalCheckPaths []string) ([]check.Check, error) {
+	checks := check.AllChecks()
+	for _, path := range externalCheckPaths {
+		c, err := check.NewExternalCheck(path)
+		if err != nil {
+			return nil, fmt.Errorf("--external-check: %w", err)
+		}
+		if findCheck(checks, c.Name) != nil {
+			return nil, fmt.Errorf("--external-check: check '%s' already exists", c.Name)
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
+
+func findCheck(checks []check.Check, checkName string) *check.Check {
+	for i := range checks {
+		if checks[i].Name == checkName {
+			return &checks[i]
+		}
+	}
+	return nil
+}
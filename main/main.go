@@ -18,8 +18,18 @@ import (
 
 var flag struct {
 	SelectedCheckNames     []string        `json:"selected_checks,omitempty"`
+	SkippedCheckNames      []string        `json:"skip_checks,omitempty"`
+	Tags                   []string        `json:"tags,omitempty"`
+	ExcludedTags           []string        `json:"exclude_tags,omitempty"`
 	ServerCommand          string          `json:"server_command,omitempty"`
+	Servers                []string        `json:"servers,omitempty"`
+	ExternalChecks         []string        `json:"external_checks,omitempty"`
 	HealthCheckPath        string          `json:"health_check_path"`
+	ReservedPath           string          `json:"reserved_path"`
+	HealthCheckMethod      string          `json:"health_check_method,omitempty"`
+	HealthCheckStatus      int             `json:"health_check_expected_status,omitempty"`
+	ReadinessStrategy      string          `json:"readiness_strategy,omitempty"`
+	ReadinessLogRegex      string          `json:"readiness_log_regex,omitempty"`
 	ServerSchemalessUrl    string          `json:"server_schemaless_url,omitempty"`
 	TlsSkipVerify          bool            `json:"tls_skip_verify"`
 	Http1_0                bool            `json:"http1.0"`
@@ -28,6 +38,7 @@ var flag struct {
 	Http1_1Tls             bool            `json:"http1.1-tls"`
 	H2                     bool            `json:"h2"`
 	H2c                    bool            `json:"h2c"`
+	H2cUpgrade             bool            `json:"h2c-upgrade"`
 	H3                     bool            `json:"h3"`
 	Compromises            []string        `json:"compromise,omitempty"`
 	LongTransferBytePerSec int             `json:"long_transfer_speed_byte,omitempty"`
@@ -36,6 +47,32 @@ var flag struct {
 	NSimultaneousRequests  int             `json:"n_simultaneous_requests"`
 	Concurrency            uint            `json:"concurrency"`
 	ResultJSONLPath        string          `json:"result_jsonl_path,omitempty"`
+	JunitPath              string          `json:"junit_path,omitempty"`
+	ExpectationsPath       string          `json:"expectations,omitempty"`
+	ServerLogDir           string          `json:"server_log_dir,omitempty"`
+	HarDir                 string          `json:"har_dir,omitempty"`
+	HarMaxBodySize         string          `json:"har_max_body_size,omitempty"`
+	ServerLifecycle        string          `json:"server_lifecycle,omitempty"`
+	ServerResourceWarning  string          `json:"server_resource_warning,omitempty"`
+	ServerResourceError    string          `json:"server_resource_error,omitempty"`
+	Repeat                 int             `json:"repeat"`
+	RetryFailed            int             `json:"retry_failed"`
+	WriteExpectationsPath  string          `json:"write_expectations,omitempty"`
+	ConfigPath             string          `json:"config,omitempty"`
+	ConfigProfile          string          `json:"profile"`
+	// Resolved values are in "config" of the header
+	ExternalCheckTimeout                             time.Duration `json:"-"`
+	ServerResourceSampleInterval                     time.Duration `json:"-"`
+	ReadinessTimeout                                 time.Duration `json:"-"`
+	SenderResponseBeforeReceiverTimeout              time.Duration `json:"-"`
+	FirstByteCheckTimeout                            time.Duration `json:"-"`
+	GetResponseReceivedTimeout                       time.Duration `json:"-"`
+	GetReqWroteRequestWaitForH3                      time.Duration `json:"-"`
+	WaitDurationAfterSenderCancel                    time.Duration `json:"-"`
+	WaitDurationBetweenReceiverWroteRequestAndCancel time.Duration `json:"-"`
+	WaitDurationAfterReceiverCancel                  time.Duration `json:"-"`
+	FixedLengthBodyGetTimeout                        time.Duration `json:"-"`
+	ServiceWorkerRejectionTimeout                    time.Duration `json:"-"`
 }
 
 type jsonDuration struct {
@@ -48,9 +85,22 @@ func (d *jsonDuration) MarshalJSON() ([]byte, error) {
 
 func init() {
 	cobra.OnInitialize()
-	rootCmd.PersistentFlags().StringArrayVarP(&flag.SelectedCheckNames, "check", "", nil, "Check selectively by check name. Without this check all.")
+	defaultConfig := defaultConfigProfile()
+	rootCmd.PersistentFlags().StringArrayVarP(&flag.SelectedCheckNames, "check", "", nil, "Check selectively by check name. Without this check all. Glob and protocol are available (e.g. --check 'post_first*' --check h3/get_first)")
+	rootCmd.PersistentFlags().StringArrayVarP(&flag.SkippedCheckNames, "skip-check", "", nil, "Skip checks by check name in the same syntax as --check")
+	rootCmd.PersistentFlags().StringArrayVarP(&flag.Tags, "tag", "", nil, fmt.Sprintf("Check selectively by tag %v", check.AllTags()))
+	rootCmd.PersistentFlags().StringArrayVarP(&flag.ExcludedTags, "exclude-tag", "", nil, "Skip checks by tag (e.g. --exclude-tag long)")
 	rootCmd.PersistentFlags().StringVarP(&flag.ServerCommand, "server-command", "", "", "Command to run a Piping Server. Use $HTTP_PORT, $HTTPS_PORT, $SERVER_RUN_ID in command")
-	rootCmd.PersistentFlags().StringVarP(&flag.HealthCheckPath, "health-check-path", "", "/", "Health check path for server command. (e.g. /, /version)")
+	rootCmd.PersistentFlags().StringArrayVarP(&flag.Servers, "server", "", nil, "Server to compare with others by name=<command> or name=<schemaless URL> (e.g. --server ref='piping-server --http-port=$HTTP_PORT' --server fork=//localhost:8080)")
+	rootCmd.PersistentFlags().StringArrayVarP(&flag.ExternalChecks, "external-check", "", nil, "Executable to run as a check. It gets PIPING_SERVER_URL, PIPING_PROTOCOL, PIPING_PATH and PIPING_TLS_SKIP_VERIFY and prints result JSON lines")
+	rootCmd.PersistentFlags().DurationVarP(&flag.ExternalCheckTimeout, "external-check-timeout", "", defaultConfig.ExternalCheckTimeout, "Timeout of an external check excluding server start-up")
+	rootCmd.PersistentFlags().StringVarP(&flag.HealthCheckPath, "health-check-path", "", defaultConfig.HealthCheckPath, "Health check path for server command. (e.g. /, /version)")
+	rootCmd.PersistentFlags().StringVarP(&flag.ReservedPath, "reserved-path", "", defaultConfig.ReservedPath, "Path which the server responds to without waiting for a sender, such as /version of Piping Server")
+	rootCmd.PersistentFlags().StringVarP(&flag.HealthCheckMethod, "health-check-method", "", defaultConfig.HealthCheckMethod, "HTTP method of health check")
+	rootCmd.PersistentFlags().IntVarP(&flag.HealthCheckStatus, "health-check-expected-status", "", 0, "Expected status of health check. 0 means 2xx")
+	rootCmd.PersistentFlags().StringVarP(&flag.ReadinessStrategy, "readiness-strategy", "", defaultConfig.ReadinessStrategy, fmt.Sprintf("How to detect a server run by --server-command is ready %v", check.AllReadinessStrategies()))
+	rootCmd.PersistentFlags().StringVarP(&flag.ReadinessLogRegex, "readiness-log-regex", "", "", "Regular expression of a stdout or stderr line of a ready server for --readiness-strategy=log")
+	rootCmd.PersistentFlags().DurationVarP(&flag.ReadinessTimeout, "readiness-timeout", "", defaultConfig.ReadinessTimeout, "Timeout for a server run by --server-command to become ready. 0 means no timeout")
 	rootCmd.PersistentFlags().StringVarP(&flag.ServerSchemalessUrl, "server-schemaless-url", "", "", "Piping Server schemaless URL (e.g. //ppng.io/myspace)")
 	rootCmd.PersistentFlags().BoolVarP(&flag.TlsSkipVerify, "tls-skip-verify", "", false, "Skip verify TLS cert (like curl --insecure option)")
 	rootCmd.PersistentFlags().BoolVarP(&flag.Http1_0, "http1.0", "", false, "HTTP/1.0 cleartext")
@@ -59,147 +109,289 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&flag.Http1_1Tls, "http1.1-tls", "", false, "HTTP/1.1 over TLS")
 	rootCmd.PersistentFlags().BoolVarP(&flag.H2, "h2", "", false, "HTTP/2 (TLS)")
 	rootCmd.PersistentFlags().BoolVarP(&flag.H2c, "h2c", "", false, "HTTP/2 cleartext")
+	rootCmd.PersistentFlags().BoolVarP(&flag.H2cUpgrade, "h2c-upgrade", "", false, "HTTP/2 cleartext upgraded from HTTP/1.1 (Upgrade: h2c)")
 	rootCmd.PersistentFlags().BoolVarP(&flag.H3, "h3", "", false, "HTTP/3")
 	rootCmd.PersistentFlags().StringArrayVarP(&flag.Compromises, "compromise", "", nil, "Compromise results which have errors and exit 0 if no other errors exist (e.g. --compromise get_first --compromise http1.1/put.transferred)")
-	rootCmd.PersistentFlags().IntVarP(&flag.LongTransferBytePerSec, "transfer-speed-byte", "", 1024*1024, "transfer byte-per-second used in long transfer checks")
+	rootCmd.PersistentFlags().IntVarP(&flag.LongTransferBytePerSec, "transfer-speed-byte", "", defaultConfig.TransferBytePerSec, "transfer byte-per-second used in long transfer checks")
 	rootCmd.PersistentFlags().DurationSliceVarP(&flag.TransferSpans, "transfer-span", "", nil, "transfer spans used in long transfer checks (e.g. 3s)")
-	rootCmd.PersistentFlags().IntVarP(&flag.NSimultaneousRequests, "n-simultaneous-requests", "", 10, "The number of tries of simultaneous request")
-	rootCmd.PersistentFlags().UintVarP(&flag.Concurrency, "concurrency", "", 1, "1 means running check one by one. 2 means that two checks run concurrently")
-	rootCmd.PersistentFlags().StringVarP(&flag.ResultJSONLPath, "result-jsonl-path", "", "", "output file path of result JSONL")
+	rootCmd.PersistentFlags().IntVarP(&flag.NSimultaneousRequests, "n-simultaneous-requests", "", defaultConfig.NSimultaneousRequests, "The number of tries of simultaneous request")
+	rootCmd.PersistentFlags().UintVarP(&flag.Concurrency, "concurrency", "", defaultConfig.Concurrency, "1 means running check one by one. 2 means that two checks run concurrently")
+	rootCmd.PersistentFlags().StringVarP(&flag.ResultJSONLPath, "result-jsonl-path", "", "", "output file path of result JSONL. - means stdout")
+	rootCmd.PersistentFlags().StringVarP(&flag.JunitPath, "junit-path", "", "", "output file path of JUnit XML report")
+	rootCmd.PersistentFlags().StringVarP(&flag.ServerLogDir, "server-log-dir", "", "", "Directory to write <server_run_id>.stdout.log and <server_run_id>.stderr.log of servers run by --server-command")
+	rootCmd.PersistentFlags().StringVarP(&flag.HarDir, "har-dir", "", "", "Directory to write <protocol>/<check>.har of HTTP exchanges in each check")
+	rootCmd.PersistentFlags().StringVarP(&flag.HarMaxBodySize, "har-max-body-size", "", "64KiB", "Bodies in HAR files are truncated to this size")
+	rootCmd.PersistentFlags().StringVarP(&flag.ServerLifecycle, "server-lifecycle", "", defaultConfig.ServerLifecycle, fmt.Sprintf("When servers are started by --server-command %v. Shared servers are restarted if exited", check.AllServerLifecycles()))
+	rootCmd.PersistentFlags().DurationVarP(&flag.ServerResourceSampleInterval, "server-resource-sample-interval", "", defaultConfig.ServerResourceSampleInterval, "Interval of sampling RSS, CPU time, threads and open FDs of servers run by --server-command (Linux only). 0 means sampling every 500ms only if --server-resource-warning or --server-resource-error is specified")
+	rootCmd.PersistentFlags().StringVarP(&flag.ServerResourceWarning, "server-resource-warning", "", "", "Server resource usage to warn (e.g. rss=512MiB,cpu=30s,threads=100,fds=1000)")
+	rootCmd.PersistentFlags().StringVarP(&flag.ServerResourceError, "server-resource-error", "", "", "Server resource usage to fail (e.g. rss=1GiB,fds=4096)")
+	rootCmd.PersistentFlags().IntVarP(&flag.Repeat, "repeat", "", 1, "The number of attempts of each check. A result which passes only sometimes is flaky")
+	rootCmd.PersistentFlags().IntVarP(&flag.RetryFailed, "retry-failed", "", 0, "The number of additional attempts of a check which has errors until it passes")
+	rootCmd.PersistentFlags().StringVarP(&flag.ExpectationsPath, "expectations", "", "", "YAML file of expected statuses. Results deviating from it fail")
+	rootCmd.PersistentFlags().StringVarP(&flag.WriteExpectationsPath, "write-expectations", "", "", "output file path of expectations generated from errors and warnings of this run")
+	rootCmd.PersistentFlags().StringVarP(&flag.ConfigPath, "config", "", "", "YAML or JSON config file for check timings and tuning values. Options override values in the file")
+	rootCmd.PersistentFlags().StringVarP(&flag.ConfigProfile, "profile", "", defaultConfigProfileName, fmt.Sprintf("Base config profile %v. Overrides \"profile\" in config file", configProfileNames()))
+	rootCmd.PersistentFlags().DurationVarP(&flag.SenderResponseBeforeReceiverTimeout, "sender-response-before-receiver-timeout", "", defaultConfig.SenderResponseBeforeReceiverTimeout, "Timeout for sender's response before receiver's request")
+	rootCmd.PersistentFlags().DurationVarP(&flag.FirstByteCheckTimeout, "first-byte-check-timeout", "", defaultConfig.FirstByteCheckTimeout, "Timeout for the first byte in streaming checks")
+	rootCmd.PersistentFlags().DurationVarP(&flag.GetResponseReceivedTimeout, "get-response-received-timeout", "", defaultConfig.GetResponseReceivedTimeout, "Timeout for receiver's response")
+	rootCmd.PersistentFlags().DurationVarP(&flag.GetReqWroteRequestWaitForH3, "get-req-wrote-request-wait-for-h3", "", defaultConfig.GetReqWroteRequestWaitForH3, "Wait duration instead of detecting receiver's request written in HTTP/3")
+	rootCmd.PersistentFlags().DurationVarP(&flag.WaitDurationAfterSenderCancel, "wait-duration-after-sender-cancel", "", defaultConfig.WaitDurationAfterSenderCancel, "Wait duration after sender's cancel")
+	rootCmd.PersistentFlags().DurationVarP(&flag.WaitDurationBetweenReceiverWroteRequestAndCancel, "wait-duration-between-receiver-wrote-request-and-cancel", "", defaultConfig.WaitDurationBetweenReceiverWroteRequestAndCancel, "Wait duration between receiver's request written and receiver's cancel")
+	rootCmd.PersistentFlags().DurationVarP(&flag.WaitDurationAfterReceiverCancel, "wait-duration-after-receiver-cancel", "", defaultConfig.WaitDurationAfterReceiverCancel, "Wait duration after receiver's cancel")
+	rootCmd.PersistentFlags().DurationVarP(&flag.FixedLengthBodyGetTimeout, "fixed-length-body-get-timeout", "", defaultConfig.FixedLengthBodyGetTimeout, "Timeout for receiver's response of fixed-length body transfer")
+	rootCmd.PersistentFlags().DurationVarP(&flag.ServiceWorkerRejectionTimeout, "service-worker-rejection-timeout", "", defaultConfig.ServiceWorkerRejectionTimeout, "Timeout for Service Worker registration rejection")
 }
 
 var rootCmd = &cobra.Command{
 	Use:   os.Args[0],
 	Short: "Check Piping Server",
-	RunE: func(_ *cobra.Command, args []string) error {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// https://docs.github.com/en/actions/learn-github-actions/variables#default-environment-variables
 		// https://github.com/fatih/color/blob/d080a5b7925fbc23275fea62c8f5d82991bfead4/README.md?plain=1#L160
 		if os.Getenv("GITHUB_ACTIONS") == "true" {
 			color.NoColor = false
 		}
-		var commonConfig check.Config
-		if flag.ServerCommand != "" {
-			// TODO: sh -c
-			commonConfig.RunServerCmd = []string{"sh", "-c", flag.ServerCommand}
-		} else if flag.ServerSchemalessUrl != "" {
-			_, err := url.Parse(flag.ServerSchemalessUrl)
-			if err != nil || !strings.HasPrefix(flag.ServerSchemalessUrl, "//") {
-				fmt.Fprintf(os.Stderr, "--server-schemaless-url should be like '//ppng.io'\n")
-				os.Exit(1)
-			}
-			commonConfig.ServerSchemalessUrl = flag.ServerSchemalessUrl
-		} else {
-			fmt.Fprintf(os.Stderr, "Specify --server-command or --server-schemaless-url\n")
+		commonConfig, err := loadCommonConfig(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
 			os.Exit(1)
 		}
-		commonConfig.HealthCheckPath = flag.HealthCheckPath
-		checks := check.AllChecks()
-		if len(flag.SelectedCheckNames) != 0 {
-			var selectedChecks []check.Check
-			for _, c := range checks {
-				if slices.Contains(flag.SelectedCheckNames, c.Name) {
-					selectedChecks = append(selectedChecks, c)
-				}
-			}
-			checks = selectedChecks
-		}
-		var protocols []check.Protocol
-		if flag.Http1_0 {
-			protocols = append(protocols, check.ProtocolHttp1_0)
+		checks, err := allChecks(flag.ExternalChecks)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
 		}
-		if flag.Http1_0Tls {
-			protocols = append(protocols, check.ProtocolHttp1_0_tls)
+		selectors, err := parseCheckSelectors(checks, "check", flag.SelectedCheckNames)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
 		}
-		if flag.Http1_1 {
-			protocols = append(protocols, check.ProtocolHttp1_1)
+		skipSelectors, err := parseCheckSelectors(checks, "skip-check", flag.SkippedCheckNames)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
 		}
-		if flag.Http1_1Tls {
-			protocols = append(protocols, check.ProtocolHttp1_1_tls)
+		if err := validateTags("tag", flag.Tags); err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
 		}
-		if flag.H2 {
-			protocols = append(protocols, check.ProtocolH2)
+		if err := validateTags("exclude-tag", flag.ExcludedTags); err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
 		}
-		if flag.H2c {
-			protocols = append(protocols, check.ProtocolH2c)
+		if err := validateCompromises(checks, flag.Compromises); err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
 		}
-		if flag.H3 {
-			protocols = append(protocols, check.ProtocolH3)
+		var expectations []expectation
+		if flag.ExpectationsPath != "" {
+			expectations, err = loadExpectations(checks, flag.ExpectationsPath, time.Now())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%+v\n", err)
+				os.Exit(1)
+			}
 		}
+		protocols := selectedProtocols()
 		if len(protocols) == 0 {
 			fmt.Fprintf(os.Stderr, "Specify --http1.1, --http1.1-tls or other protocols to check\n")
 		}
-		commonConfig.TlsSkipVerifyCert = flag.TlsSkipVerify
-		commonConfig.Concurrency = flag.Concurrency
-		// TODO: to be option
-		commonConfig.SenderResponseBeforeReceiverTimeout = 5 * time.Second
-		// TODO: to be option
-		commonConfig.FirstByteCheckTimeout = 5 * time.Second
-		// TODO: to be option
-		commonConfig.GetResponseReceivedTimeout = 5 * time.Second
-		commonConfig.GetReqWroteRequestWaitForH3 = 3 * time.Second
-		// TODO: to be option
-		commonConfig.WaitDurationAfterSenderCancel = 1 * time.Second
-		// TODO: to be option
-		commonConfig.WaitDurationBetweenReceiverWroteRequestAndCancel = 3 * time.Second
-		// TODO: to be option
-		commonConfig.WaitDurationAfterReceiverCancel = 3 * time.Second
-		// TODO: to be option
-		commonConfig.FixedLengthBodyGetTimeout = 6 * time.Second
-		// TODO: to be option
-		commonConfig.ServiceWorkerRejectionTimeout = 3 * time.Second
-		commonConfig.TransferBytePerSec = flag.LongTransferBytePerSec
-		slices.Sort(flag.TransferSpans)
-		commonConfig.SortedTransferSpans = flag.TransferSpans
-		commonConfig.NSimultaneousRequests = flag.NSimultaneousRequests
+		targets := selectCheckTargets(checks, protocols, selectors, skipSelectors, flag.Tags, flag.ExcludedTags)
+		overrideIfFlagChanged(cmd, "tls-skip-verify", &commonConfig.TlsSkipVerifyCert, flag.TlsSkipVerify)
+		overrideIfFlagChanged(cmd, "concurrency", &commonConfig.Concurrency, flag.Concurrency)
+		if err := validateConcurrency(&commonConfig); err != nil {
+			return err
+		}
+		overrideIfFlagChanged(cmd, "sender-response-before-receiver-timeout", &commonConfig.SenderResponseBeforeReceiverTimeout, flag.SenderResponseBeforeReceiverTimeout)
+		overrideIfFlagChanged(cmd, "first-byte-check-timeout", &commonConfig.FirstByteCheckTimeout, flag.FirstByteCheckTimeout)
+		overrideIfFlagChanged(cmd, "get-response-received-timeout", &commonConfig.GetResponseReceivedTimeout, flag.GetResponseReceivedTimeout)
+		overrideIfFlagChanged(cmd, "get-req-wrote-request-wait-for-h3", &commonConfig.GetReqWroteRequestWaitForH3, flag.GetReqWroteRequestWaitForH3)
+		overrideIfFlagChanged(cmd, "wait-duration-after-sender-cancel", &commonConfig.WaitDurationAfterSenderCancel, flag.WaitDurationAfterSenderCancel)
+		overrideIfFlagChanged(cmd, "wait-duration-between-receiver-wrote-request-and-cancel", &commonConfig.WaitDurationBetweenReceiverWroteRequestAndCancel, flag.WaitDurationBetweenReceiverWroteRequestAndCancel)
+		overrideIfFlagChanged(cmd, "wait-duration-after-receiver-cancel", &commonConfig.WaitDurationAfterReceiverCancel, flag.WaitDurationAfterReceiverCancel)
+		overrideIfFlagChanged(cmd, "fixed-length-body-get-timeout", &commonConfig.FixedLengthBodyGetTimeout, flag.FixedLengthBodyGetTimeout)
+		overrideIfFlagChanged(cmd, "service-worker-rejection-timeout", &commonConfig.ServiceWorkerRejectionTimeout, flag.ServiceWorkerRejectionTimeout)
+		overrideIfFlagChanged(cmd, "transfer-speed-byte", &commonConfig.TransferBytePerSec, flag.LongTransferBytePerSec)
+		overrideIfFlagChanged(cmd, "transfer-span", &commonConfig.SortedTransferSpans, flag.TransferSpans)
+		slices.Sort(commonConfig.SortedTransferSpans)
+		overrideIfFlagChanged(cmd, "n-simultaneous-requests", &commonConfig.NSimultaneousRequests, flag.NSimultaneousRequests)
+		overrideIfFlagChanged(cmd, "repeat", &commonConfig.Repeat, flag.Repeat)
+		overrideIfFlagChanged(cmd, "server-log-dir", &commonConfig.ServerLogDir, flag.ServerLogDir)
+		if commonConfig.ServerLogDir != "" {
+			if err := os.MkdirAll(commonConfig.ServerLogDir, 0755); err != nil {
+				return err
+			}
+		}
+		overrideIfFlagChanged(cmd, "har-dir", &commonConfig.HarDir, flag.HarDir)
+		if cmd.Flags().Changed("har-max-body-size") {
+			if commonConfig.HarMaxBodySize, err = parseByteSize(flag.HarMaxBodySize); err != nil {
+				return fmt.Errorf("invalid --har-max-body-size: %w", err)
+			}
+		}
+		overrideIfFlagChanged(cmd, "retry-failed", &commonConfig.RetryFailed, flag.RetryFailed)
+		overrideIfFlagChanged(cmd, "external-check-timeout", &commonConfig.ExternalCheckTimeout, flag.ExternalCheckTimeout)
+		overrideIfFlagChanged(cmd, "server-lifecycle", &commonConfig.ServerLifecycle, flag.ServerLifecycle)
+		if commonConfig.ServerLifecycle != "" && !slices.Contains(check.AllServerLifecycles(), commonConfig.ServerLifecycle) {
+			return fmt.Errorf("unknown server lifecycle '%s' (available: %v)", commonConfig.ServerLifecycle, check.AllServerLifecycles())
+		}
+		overrideIfFlagChanged(cmd, "server-resource-sample-interval", &commonConfig.ServerResourceSampleInterval, flag.ServerResourceSampleInterval)
+		if cmd.Flags().Changed("server-resource-warning") {
+			if commonConfig.ServerResourceWarningThreshold, err = parseServerResourceThreshold(flag.ServerResourceWarning); err != nil {
+				return fmt.Errorf("invalid --server-resource-warning: %w", err)
+			}
+		}
+		if cmd.Flags().Changed("server-resource-error") {
+			if commonConfig.ServerResourceErrorThreshold, err = parseServerResourceThreshold(flag.ServerResourceError); err != nil {
+				return fmt.Errorf("invalid --server-resource-error: %w", err)
+			}
+		}
+
+		serverConfigs, err := serverConfigsByFlag(&commonConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+		var serverNames []string
+		for _, serverConfig := range serverConfigs {
+			serverNames = append(serverNames, serverConfig.ServerName)
+		}
+		matrix := newConformanceMatrix(serverNames)
 
 		shouldExitWithNonZero := false
-		var jsonlBytes []byte
+		jsonl, err := newJsonlWriter(flag.ResultJSONLPath)
+		if err != nil {
+			return err
+		}
+		defer jsonl.close()
+		// JSONL in stdout should not be mixed with colored lines
+		console := os.Stdout
+		if flag.ResultJSONLPath == "-" {
+			console = os.Stderr
+		}
 		for _, duration := range flag.TransferSpans {
 			flag.TransferSpansForJson = append(flag.TransferSpansForJson, jsonDuration{duration})
 		}
-		header := struct {
-			Version string `json:"version"`
-			Engine  string `json:"engine"`
-			Os      string `json:"os"`
-			Arch    string `json:"arch"`
-			Options any    `json:"options"`
-		}{
+		resolvedConfig, err := configForJson(&commonConfig)
+		if err != nil {
+			return err
+		}
+		header := jsonlHeader{
 			Version: version.Version,
 			Engine:  runtime.Version(),
 			Os:      runtime.GOOS,
 			Arch:    runtime.GOARCH,
 			Options: flag,
+			Config:  resolvedConfig,
 		}
 		jsonBytes, err := json.Marshal(&header)
 		if err != nil {
 			return err
 		}
-		jsonlBytes = append(jsonlBytes, append(jsonBytes, 10)...)
-		fmt.Println(fmt.Sprintf("　 %s", string(jsonBytes)))
+		if err := jsonl.write(jsonBytes); err != nil {
+			return err
+		}
+		fmt.Fprintln(console, fmt.Sprintf("　 %s", string(jsonBytes)))
+		var expiredExpectations []expectation
+		for _, e := range expectations {
+			if e.expired {
+				expiredExpectations = append(expiredExpectations, e)
+			}
+		}
+		if len(expiredExpectations) != 0 {
+			jsonBytes, err := json.Marshal(&struct {
+				ExpiredExpectations []expectation `json:"expired_expectations"`
+			}{ExpiredExpectations: expiredExpectations})
+			if err != nil {
+				return err
+			}
+			if err := jsonl.write(jsonBytes); err != nil {
+				return err
+			}
+			fmt.Fprintln(console, color.YellowString(fmt.Sprintf("⚠︎ %s", string(jsonBytes))))
+		}
 		usedCompromises := mapset.NewSet[string]()
+		statusCounts := make(map[check.ResultStatus]int)
+		nCompromised := 0
+		junit := newJunitReport()
+		var expectationDeviations []*expectationDeviation
+		// for --write-expectations
+		var results []check.Result
 		// TODO: output version
-		for result := range check.RunChecks(checks, &commonConfig, protocols) {
+		for result := range runCheckTargetsOnServers(targets, serverConfigs) {
 			jsonBytes, err := json.Marshal(&result)
 			if err != nil {
 				return err
 			}
 			line := string(jsonBytes)
-			jsonlBytes = append(jsonlBytes, append(jsonBytes, 10)...)
-			if len(result.Errors) != 0 {
-				compromise := findCompromise(&result)
-				if compromise == "" {
+			if err := jsonl.write(jsonBytes); err != nil {
+				return err
+			}
+			statusCounts[result.Status]++
+			if flag.WriteExpectationsPath != "" {
+				results = append(results, result)
+			}
+			compromise := ""
+			if result.Status == check.ResultStatusError {
+				compromise = findCompromise(&result)
+			}
+			matchedExpectation := findExpectation(expectations, &result)
+			if matchedExpectation != nil {
+				matchedExpectation.matched = true
+			}
+			if flag.ExpectationsPath != "" {
+				if deviation := findExpectationDeviation(matchedExpectation, &result, compromise); deviation != nil {
+					expectationDeviations = append(expectationDeviations, deviation)
+				}
+			}
+			allowedErrorMessage := ""
+			if compromise != "" {
+				allowedErrorMessage = fmt.Sprintf("compromised by --compromise %s", compromise)
+			} else if matchedExpectation != nil && matchedExpectation.Status == check.ResultStatusError {
+				allowedErrorMessage = fmt.Sprintf("expected by --expectations: %s", matchedExpectation.Reason)
+			}
+			junit.add(&result, allowedErrorMessage)
+			matrix.add(&result)
+			switch result.Status {
+			case check.ResultStatusError:
+				if allowedErrorMessage == "" {
 					shouldExitWithNonZero = true
 					line = color.RedString(fmt.Sprintf("✖︎ %s", line))
 				} else {
-					usedCompromises.Add(compromise)
+					nCompromised++
+					if compromise != "" {
+						usedCompromises.Add(compromise)
+					}
 					line = color.MagentaString(fmt.Sprintf("✖︎ %s", line))
 				}
-			} else if len(result.Warnings) != 0 {
+			case check.ResultStatusWarning:
 				line = color.YellowString(fmt.Sprintf("⚠︎ %s", line))
-			} else {
+			case check.ResultStatusFlaky:
+				line = color.BlueString(fmt.Sprintf("≈ %s", line))
+			case check.ResultStatusSkipped:
+				line = color.CyanString(fmt.Sprintf("⏭︎ %s", line))
+			default:
 				line = color.GreenString(fmt.Sprintf("✔︎ %s", line))
 			}
-			fmt.Println(line)
+			fmt.Fprintln(console, line)
+		}
+		fmt.Fprintf(console, "%s, %s, %s, %s (compromised: %d), %s\n",
+			color.GreenString("ok: %d", statusCounts[check.ResultStatusOk]),
+			color.YellowString("warning: %d", statusCounts[check.ResultStatusWarning]),
+			color.BlueString("flaky: %d", statusCounts[check.ResultStatusFlaky]),
+			color.RedString("error: %d", statusCounts[check.ResultStatusError]),
+			nCompromised,
+			color.CyanString("skipped: %d", statusCounts[check.ResultStatusSkipped]),
+		)
+		if len(flag.Servers) != 0 {
+			matrix.print(console)
+			jsonBytes, err := json.Marshal(&struct {
+				Matrix *conformanceMatrix `json:"conformance_matrix"`
+			}{Matrix: matrix})
+			if err != nil {
+				return err
+			}
+			if err := jsonl.write(jsonBytes); err != nil {
+				return err
+			}
 		}
 		unusedCompromises := mapset.NewSet(flag.Compromises...).Difference(usedCompromises).ToSlice()
 		if len(unusedCompromises) != 0 {
@@ -212,15 +404,60 @@ var rootCmd = &cobra.Command{
 			if err != nil {
 				return err
 			}
-			jsonlBytes = append(jsonlBytes, append(jsonBytes, 10)...)
+			if err := jsonl.write(jsonBytes); err != nil {
+				return err
+			}
 			line := color.YellowString(fmt.Sprintf("⚠︎ %s", string(jsonBytes)))
-			fmt.Println(line)
+			fmt.Fprintln(console, line)
 		}
-		if flag.ResultJSONLPath != "" {
-			err := os.WriteFile(flag.ResultJSONLPath, jsonlBytes, 0644)
+		expectationDeviations = append(expectationDeviations, findUnmatchedExpectationDeviations(expectations, targets)...)
+		if len(expectationDeviations) != 0 {
+			shouldExitWithNonZero = true
+			jsonBytes, err := json.Marshal(&struct {
+				ExpectationDeviations []*expectationDeviation `json:"expectation_deviations"`
+			}{ExpectationDeviations: expectationDeviations})
 			if err != nil {
 				return err
 			}
+			if err := jsonl.write(jsonBytes); err != nil {
+				return err
+			}
+			fmt.Fprintln(console, color.RedString(fmt.Sprintf("✖︎ %s", string(jsonBytes))))
+		}
+		summary := resultSummary{
+			Ok:                    statusCounts[check.ResultStatusOk],
+			Warning:               statusCounts[check.ResultStatusWarning],
+			Flaky:                 statusCounts[check.ResultStatusFlaky],
+			Error:                 statusCounts[check.ResultStatusError],
+			Compromised:           nCompromised,
+			Skipped:               statusCounts[check.ResultStatusSkipped],
+			ExpectationDeviations: len(expectationDeviations),
+		}
+		if shouldExitWithNonZero {
+			summary.ExitStatus = 1
+		}
+		jsonBytes, err = json.Marshal(&struct {
+			Summary resultSummary `json:"summary"`
+		}{Summary: summary})
+		if err != nil {
+			return err
+		}
+		if err := jsonl.write(jsonBytes); err != nil {
+			return err
+		}
+		if flag.WriteExpectationsPath != "" {
+			if err := writeExpectations(flag.WriteExpectationsPath, results); err != nil {
+				return err
+			}
+		}
+		if flag.JunitPath != "" {
+			if err := junit.write(flag.JunitPath); err != nil {
+				return err
+			}
+		}
+		// os.Exit() skips the deferred close
+		if err := jsonl.close(); err != nil {
+			return err
 		}
 		if shouldExitWithNonZero {
 			os.Exit(1)
@@ -229,13 +466,105 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// loadCommonConfig loads the config and applies options of the server and its readiness
+func loadCommonConfig(cmd *cobra.Command) (check.Config, error) {
+	commonConfig, profileName, err := loadConfig(flag.ConfigProfile, cmd.Flags().Changed("profile"), flag.ConfigPath)
+	if err != nil {
+		return check.Config{}, err
+	}
+	flag.ConfigProfile = profileName
+	if flag.ServerCommand != "" {
+		// TODO: sh -c
+		commonConfig.RunServerCmd = []string{"sh", "-c", flag.ServerCommand}
+		commonConfig.ServerSchemalessUrl = ""
+	} else if flag.ServerSchemalessUrl != "" {
+		commonConfig.RunServerCmd = nil
+		commonConfig.ServerSchemalessUrl = flag.ServerSchemalessUrl
+	}
+	if len(flag.Servers) != 0 && (flag.ServerCommand != "" || flag.ServerSchemalessUrl != "") {
+		return check.Config{}, fmt.Errorf("--server cannot be used with --server-command or --server-schemaless-url")
+	}
+	if len(flag.Servers) == 0 && len(commonConfig.RunServerCmd) == 0 && commonConfig.ServerSchemalessUrl == "" {
+		return check.Config{}, fmt.Errorf("Specify --server-command, --server-schemaless-url or --server")
+	}
+	if commonConfig.ServerSchemalessUrl != "" {
+		_, err := url.Parse(commonConfig.ServerSchemalessUrl)
+		if err != nil || !strings.HasPrefix(commonConfig.ServerSchemalessUrl, "//") {
+			return check.Config{}, fmt.Errorf("--server-schemaless-url should be like '//ppng.io'")
+		}
+	}
+	overrideIfFlagChanged(cmd, "health-check-path", &commonConfig.HealthCheckPath, flag.HealthCheckPath)
+	overrideIfFlagChanged(cmd, "reserved-path", &commonConfig.ReservedPath, flag.ReservedPath)
+	overrideIfFlagChanged(cmd, "health-check-method", &commonConfig.HealthCheckMethod, flag.HealthCheckMethod)
+	overrideIfFlagChanged(cmd, "health-check-expected-status", &commonConfig.HealthCheckExpectedStatus, flag.HealthCheckStatus)
+	overrideIfFlagChanged(cmd, "readiness-strategy", &commonConfig.ReadinessStrategy, flag.ReadinessStrategy)
+	overrideIfFlagChanged(cmd, "readiness-log-regex", &commonConfig.ReadinessLogRegex, flag.ReadinessLogRegex)
+	overrideIfFlagChanged(cmd, "readiness-timeout", &commonConfig.ReadinessTimeout, flag.ReadinessTimeout)
+	if err := validateReadiness(&commonConfig); err != nil {
+		return check.Config{}, err
+	}
+	return commonConfig, nil
+}
+
+func selectedProtocols() []check.Protocol {
+	var protocols []check.Protocol
+	if flag.Http1_0 {
+		protocols = append(protocols, check.ProtocolHttp1_0)
+	}
+	if flag.Http1_0Tls {
+		protocols = append(protocols, check.ProtocolHttp1_0_tls)
+	}
+	if flag.Http1_1 {
+		protocols = append(protocols, check.ProtocolHttp1_1)
+	}
+	if flag.Http1_1Tls {
+		protocols = append(protocols, check.ProtocolHttp1_1_tls)
+	}
+	if flag.H2 {
+		protocols = append(protocols, check.ProtocolH2)
+	}
+	if flag.H2c {
+		protocols = append(protocols, check.ProtocolH2c)
+	}
+	if flag.H2cUpgrade {
+		protocols = append(protocols, check.ProtocolH2cUpgrade)
+	}
+	if flag.H3 {
+		protocols = append(protocols, check.ProtocolH3)
+	}
+	return protocols
+}
+
+// serverConfigsByFlag returns a config of each --server or commonConfig itself
+func serverConfigsByFlag(commonConfig *check.Config) ([]check.Config, error) {
+	if len(flag.Servers) == 0 {
+		return []check.Config{*commonConfig}, nil
+	}
+	serverConfigs, err := parseServerConfigs(commonConfig, flag.Servers)
+	if err != nil {
+		return nil, err
+	}
+	for _, serverConfig := range serverConfigs {
+		if serverConfig.ServerSchemalessUrl != "" {
+			if _, err := url.Parse(serverConfig.ServerSchemalessUrl); err != nil {
+				return nil, fmt.Errorf("invalid URL of --server %s: %+v", serverConfig.ServerName, err)
+			}
+		}
+	}
+	return serverConfigs, nil
+}
+
+func overrideIfFlagChanged[T any](cmd *cobra.Command, flagName string, dst *T, value T) {
+	if cmd.Flags().Changed(flagName) {
+		*dst = value
+	}
+}
+
 func findCompromise(result *check.Result) string /* empty string means not found */ {
 	for _, compromise := range flag.Compromises {
-		splits := strings.SplitN(compromise, "/", 2)
-		if len(splits) == 1 && splits[0] == result.Name {
-			return compromise
-		}
-		if len(splits) == 2 && check.Protocol(splits[0]) == result.Protocol && splits[1] == result.Name {
+		// already validated
+		protocol, resultName, _ := parseProtocolQualified(compromise)
+		if (protocol == "" || protocol == result.Protocol) && resultName == result.Name {
 			return compromise
 		}
 	}
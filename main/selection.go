@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nwtgck/piping-server-check/check"
+	"golang.org/x/exp/slices"
+	"os"
+	"path"
+	"strings"
+)
+
+// checkSelector is "<check name glob>" or "<protocol>/<check name glob>" (e.g. post_first*, h3/get_first)
+type checkSelector struct {
+	// empty means all protocols
+	protocol check.Protocol
+	pattern  string
+}
+
+// parseProtocolQualified splits "<protocol>/<name>" into the protocol and the name. The protocol is empty for "<name>".
+func parseProtocolQualified(s string) (check.Protocol, string, error) {
+	splits := strings.SplitN(s, "/", 2)
+	if len(splits) == 1 {
+		return "", s, nil
+	}
+	protocol := check.Protocol(splits[0])
+	if !slices.Contains(check.AllProtocols(), protocol) {
+		return "", "", fmt.Errorf("unknown protocol '%s' in %s", splits[0], s)
+	}
+	return protocol, splits[1], nil
+}
+
+func parseCheckSelectors(checks []check.Check, flagName string, selectorStrs []string) ([]checkSelector, error) {
+	var selectors []checkSelector
+	for _, selectorStr := range selectorStrs {
+		protocol, pattern, err := parseProtocolQualified(selectorStr)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: %w", flagName, err)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("--%s: malformed pattern '%s': %w", flagName, pattern, err)
+		}
+		selector := checkSelector{protocol: protocol, pattern: pattern}
+		if !slices.ContainsFunc(checks, selector.matchName) {
+			return nil, fmt.Errorf("--%s: no check matches '%s'. See `%s list`", flagName, selectorStr, os.Args[0])
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+func (s checkSelector) matchName(c check.Check) bool {
+	// pattern is already validated
+	matched, _ := path.Match(s.pattern, c.Name)
+	return matched
+}
+
+func (s checkSelector) match(target check.CheckTarget) bool {
+	return (s.protocol == "" || s.protocol == target.Protocol) && s.matchName(target.Check)
+}
+
+func validateTags(flagName string, tags []string) error {
+	for _, tag := range tags {
+		if !slices.Contains(check.AllTags(), tag) {
+			return fmt.Errorf("--%s: unknown tag '%s' (available: %v)", flagName, tag, check.AllTags())
+		}
+	}
+	return nil
+}
+
+// selectCheckTargets selects all targets if both selectors and tags are empty
+func selectCheckTargets(checks []check.Check, protocols []check.Protocol, selectors []checkSelector, skipSelectors []checkSelector, tags []string, excludedTags []string) []check.CheckTarget {
+	var targets []check.CheckTarget
+	for _, c := range checks {
+		for _, protocol := range protocols {
+			target := check.CheckTarget{Check: c, Protocol: protocol}
+			if len(selectors) != 0 && !slices.ContainsFunc(selectors, func(s checkSelector) bool { return s.match(target) }) {
+				continue
+			}
+			if len(tags) != 0 && !slices.ContainsFunc(c.Tags, func(tag string) bool { return slices.Contains(tags, tag) }) {
+				continue
+			}
+			if slices.ContainsFunc(skipSelectors, func(s checkSelector) bool { return s.match(target) }) {
+				continue
+			}
+			if slices.ContainsFunc(c.Tags, func(tag string) bool { return slices.Contains(excludedTags, tag) }) {
+				continue
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/nwtgck/piping-server-check/check"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var selectionTestChecks = []check.Check{
+	{Name: "get_first", Tags: []string{check.TagBasic}},
+	{Name: "post_first", Tags: []string{check.TagBasic}},
+	{Name: "post_first_chunked_long_transfer", Tags: []string{check.TagStreaming, check.TagLong}},
+	{Name: "simultaneous_request", Tags: []string{check.TagLong}},
+}
+
+func TestParseCheckSelectors(t *testing.T) {
+	for _, tc := range []struct {
+		selectors     []string
+		expected      []checkSelector
+		expectedError string
+	}{
+		{selectors: nil, expected: nil},
+		{selectors: []string{"get_first"}, expected: []checkSelector{{pattern: "get_first"}}},
+		{selectors: []string{"post_first*", "h3/get_first"}, expected: []checkSelector{{pattern: "post_first*"}, {protocol: check.ProtocolH3, pattern: "get_first"}}},
+		{selectors: []string{"no_such_check"}, expectedError: "--check: no check matches 'no_such_check'"},
+		{selectors: []string{"get_first*x"}, expectedError: "--check: no check matches 'get_first*x'"},
+		{selectors: []string{"h4/get_first"}, expectedError: "--check: unknown protocol 'h4' in h4/get_first"},
+		{selectors: []string{"get_first["}, expectedError: "--check: malformed pattern 'get_first['"},
+	} {
+		selectors, err := parseCheckSelectors(selectionTestChecks, "check", tc.selectors)
+		if tc.expectedError != "" {
+			assert.ErrorContains(t, err, tc.expectedError, tc.selectors)
+			continue
+		}
+		assert.NoError(t, err, tc.selectors)
+		assert.Equal(t, tc.expected, selectors, tc.selectors)
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	assert.NoError(t, validateTags("tag", []string{check.TagBasic, check.TagLong}))
+	assert.ErrorContains(t, validateTags("exclude-tag", []string{"no_such_tag"}), "--exclude-tag: unknown tag 'no_such_tag'")
+}
+
+func TestSelectCheckTargets(t *testing.T) {
+	protocols := []check.Protocol{check.ProtocolHttp1_1, check.ProtocolH2c}
+	for _, tc := range []struct {
+		name          string
+		selectors     []string
+		skipSelectors []string
+		tags          []string
+		excludedTags  []string
+		// "<protocol>/<check name>"
+		expected []string
+	}{
+		{
+			name:     "all",
+			expected: []string{"http1.1/get_first", "h2c/get_first", "http1.1/post_first", "h2c/post_first", "http1.1/post_first_chunked_long_transfer", "h2c/post_first_chunked_long_transfer", "http1.1/simultaneous_request", "h2c/simultaneous_request"},
+		},
+		{
+			name:      "glob",
+			selectors: []string{"post_first*"},
+			expected:  []string{"http1.1/post_first", "h2c/post_first", "http1.1/post_first_chunked_long_transfer", "h2c/post_first_chunked_long_transfer"},
+		},
+		{
+			name:      "protocol qualified",
+			selectors: []string{"h2c/get_first", "post_first"},
+			expected:  []string{"h2c/get_first", "http1.1/post_first", "h2c/post_first"},
+		},
+		{
+			name:          "skip",
+			skipSelectors: []string{"get_first", "http1.1/simultaneous_request", "*long*"},
+			expected:      []string{"http1.1/post_first", "h2c/post_first", "h2c/simultaneous_request"},
+		},
+		{
+			name:          "skip overlapping check",
+			selectors:     []string{"post_first*"},
+			skipSelectors: []string{"post_first_chunked_long_transfer", "h2c/post_first"},
+			expected:      []string{"http1.1/post_first"},
+		},
+		{
+			name:     "tag",
+			tags:     []string{check.TagLong},
+			expected: []string{"http1.1/post_first_chunked_long_transfer", "h2c/post_first_chunked_long_transfer", "http1.1/simultaneous_request", "h2c/simultaneous_request"},
+		},
+		{
+			name:      "check and tag",
+			selectors: []string{"post_first*"},
+			tags:      []string{check.TagBasic},
+			expected:  []string{"http1.1/post_first", "h2c/post_first"},
+		},
+		{
+			name:         "exclude tag",
+			excludedTags: []string{check.TagLong},
+			expected:     []string{"http1.1/get_first", "h2c/get_first", "http1.1/post_first", "h2c/post_first"},
+		},
+		{
+			name:         "overlapping tag and excluded tag",
+			tags:         []string{check.TagStreaming},
+			excludedTags: []string{check.TagLong},
+			expected:     nil,
+		},
+		{
+			name:     "tag of no check",
+			tags:     []string{check.TagSecurity},
+			expected: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			selectors, err := parseCheckSelectors(selectionTestChecks, "check", tc.selectors)
+			assert.NoError(t, err)
+			skipSelectors, err := parseCheckSelectors(selectionTestChecks, "skip-check", tc.skipSelectors)
+			assert.NoError(t, err)
+			var targets []string
+			for _, target := range selectCheckTargets(selectionTestChecks, protocols, selectors, skipSelectors, tc.tags, tc.excludedTags) {
+				targets = append(targets, string(target.Protocol)+"/"+target.Check.Name)
+			}
+			assert.Equal(t, tc.expected, targets)
+		})
+	}
+}
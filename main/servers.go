@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/nwtgck/piping-server-check/check"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var serverNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// parseServerConfigs parses --server "<name>=<command>" or "<name>=<schemaless URL>" into configs based on commonConfig
+func parseServerConfigs(commonConfig *check.Config, serverFlags []string) ([]check.Config, error) {
+	var configs []check.Config
+	var names []string
+	for _, serverFlag := range serverFlags {
+		name, value, found := strings.Cut(serverFlag, "=")
+		if !found || value == "" {
+			return nil, fmt.Errorf("--server should be like 'name=<command>' or 'name=//ppng.io': %s", serverFlag)
+		}
+		if !serverNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("server name should match %s: %s", serverNameRegexp, name)
+		}
+		for _, n := range names {
+			if n == name {
+				return nil, fmt.Errorf("duplicate server name: %s", name)
+			}
+		}
+		names = append(names, name)
+		config := *commonConfig
+		config.ServerName = name
+		if strings.HasPrefix(value, "//") {
+			config.RunServerCmd = nil
+			config.ServerSchemalessUrl = value
+		} else {
+			config.RunServerCmd = []string{"sh", "-c", value}
+			config.ServerSchemalessUrl = ""
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// runCheckTargetsOnServers runs the targets on the servers one by one
+func runCheckTargetsOnServers(targets []check.CheckTarget, serverConfigs []check.Config) <-chan check.Result {
+	ch := make(chan check.Result)
+	go func() {
+		for i := range serverConfigs {
+			for result := range check.RunCheckTargets(targets, &serverConfigs[i]) {
+				ch <- result
+			}
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// conformanceMatrix is statuses of each result against each server
+type conformanceMatrix struct {
+	Servers []string                `json:"servers"`
+	Rows    []*conformanceMatrixRow `json:"rows"`
+}
+
+type conformanceMatrixRow struct {
+	Protocol check.Protocol `json:"protocol"`
+	Name     string         `json:"name"`
+	// key: server name
+	Statuses map[string]check.ResultStatus `json:"statuses"`
+}
+
+func newConformanceMatrix(servers []string) *conformanceMatrix {
+	return &conformanceMatrix{Servers: servers}
+}
+
+func (m *conformanceMatrix) add(result *check.Result) {
+	var row *conformanceMatrixRow
+	for _, r := range m.Rows {
+		if r.Protocol == result.Protocol && r.Name == result.Name {
+			row = r
+		}
+	}
+	if row == nil {
+		row = &conformanceMatrixRow{Protocol: result.Protocol, Name: result.Name, Statuses: make(map[string]check.ResultStatus)}
+		m.Rows = append(m.Rows, row)
+	}
+	// The same name can appear multiple times (e.g. partial_transfer). The worst one represents them.
+	if status, ok := row.Statuses[result.Server]; !ok || resultStatusSeverity(result.Status) > resultStatusSeverity(status) {
+		row.Statuses[result.Server] = result.Status
+	}
+}
+
+func (m *conformanceMatrix) print(w io.Writer) {
+	firstColumnWidth := len("protocol/result")
+	for _, row := range m.Rows {
+		firstColumnWidth = max(firstColumnWidth, len(string(row.Protocol)+"/"+row.Name))
+	}
+	columnWidths := make([]int, len(m.Servers))
+	for i, server := range m.Servers {
+		columnWidths[i] = max(len(server), len(check.ResultStatusSkipped))
+	}
+	fmt.Fprintf(w, "%-*s", firstColumnWidth, "protocol/result")
+	for i, server := range m.Servers {
+		fmt.Fprintf(w, "  %-*s", columnWidths[i], server)
+	}
+	fmt.Fprintln(w)
+	for _, row := range m.Rows {
+		fmt.Fprintf(w, "%-*s", firstColumnWidth, string(row.Protocol)+"/"+row.Name)
+		for i, server := range m.Servers {
+			status, ok := row.Statuses[server]
+			cell := fmt.Sprintf("%-*s", columnWidths[i], "-")
+			if ok {
+				// Pad before coloring because escape sequences have no width
+				cell = colorByStatus(status, fmt.Sprintf("%-*s", columnWidths[i], status))
+			}
+			fmt.Fprintf(w, "  %s", cell)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func colorByStatus(status check.ResultStatus, s string) string {
+	switch status {
+	case check.ResultStatusOk:
+		return color.GreenString("%s", s)
+	case check.ResultStatusWarning:
+		return color.YellowString("%s", s)
+	case check.ResultStatusFlaky:
+		return color.BlueString("%s", s)
+	case check.ResultStatusError:
+		return color.RedString("%s", s)
+	case check.ResultStatusSkipped:
+		return color.CyanString("%s", s)
+	}
+	return s
+}
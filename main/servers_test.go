@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"github.com/fatih/color"
+	"github.com/nwtgck/piping-server-check/check"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseServerConfigs(t *testing.T) {
+	commonConfig := check.Config{
+		RunServerCmd: []string{"sh", "-c", "piping-server"},
+		Concurrency:  2,
+	}
+	for _, tc := range []struct {
+		name          string
+		serverFlags   []string
+		expected      []check.Config
+		expectedError string
+	}{
+		{
+			name:        "command and URL",
+			serverFlags: []string{"local=piping-server --http-port=$HTTP_PORT", "public=//ppng.io/prefix"},
+			expected: []check.Config{
+				{ServerName: "local", RunServerCmd: []string{"sh", "-c", "piping-server --http-port=$HTTP_PORT"}, Concurrency: 2},
+				{ServerName: "public", ServerSchemalessUrl: "//ppng.io/prefix", Concurrency: 2},
+			},
+		},
+		{
+			name:        "equal sign in command",
+			serverFlags: []string{"v1.0_a-b=FOO=1 piping-server"},
+			expected: []check.Config{
+				{ServerName: "v1.0_a-b", RunServerCmd: []string{"sh", "-c", "FOO=1 piping-server"}, Concurrency: 2},
+			},
+		},
+		{
+			name:          "no equal sign",
+			serverFlags:   []string{"piping-server"},
+			expectedError: "--server should be like 'name=<command>' or 'name=//ppng.io': piping-server",
+		},
+		{
+			name:          "empty value",
+			serverFlags:   []string{"local="},
+			expectedError: "--server should be like 'name=<command>' or 'name=//ppng.io': local=",
+		},
+		{
+			name:          "empty name",
+			serverFlags:   []string{"=//ppng.io"},
+			expectedError: "server name should match",
+		},
+		{
+			name:          "invalid name",
+			serverFlags:   []string{"my server=//ppng.io"},
+			expectedError: "server name should match ^[A-Za-z0-9_.-]+$: my server",
+		},
+		{
+			name:          "name with slash",
+			serverFlags:   []string{"a/b=//ppng.io"},
+			expectedError: "server name should match ^[A-Za-z0-9_.-]+$: a/b",
+		},
+		{
+			name:          "duplicate name",
+			serverFlags:   []string{"local=piping-server", "local=//ppng.io"},
+			expectedError: "duplicate server name: local",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			configs, err := parseServerConfigs(&commonConfig, tc.serverFlags)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, configs)
+		})
+	}
+	// commonConfig is not modified
+	assert.Equal(t, []string{"sh", "-c", "piping-server"}, commonConfig.RunServerCmd)
+}
+
+func TestConformanceMatrix(t *testing.T) {
+	m := newConformanceMatrix([]string{"a", "b"})
+	for _, result := range []check.Result{
+		{Server: "a", Protocol: check.ProtocolHttp1_1, Name: "get_first", Status: check.ResultStatusOk},
+		{Server: "a", Protocol: check.ProtocolHttp1_1, Name: "post_cancel_post.partial_transfer", Status: check.ResultStatusOk},
+		{Server: "a", Protocol: check.ProtocolHttp1_1, Name: "post_cancel_post.partial_transfer", Status: check.ResultStatusError},
+		{Server: "a", Protocol: check.ProtocolHttp1_1, Name: "post_cancel_post.partial_transfer", Status: check.ResultStatusWarning},
+		{Server: "a", Protocol: check.ProtocolH2c, Name: "get_first", Status: check.ResultStatusSkipped},
+		{Server: "b", Protocol: check.ProtocolHttp1_1, Name: "get_first", Status: check.ResultStatusWarning},
+		{Server: "b", Protocol: check.ProtocolHttp1_1, Name: "get_first", Status: check.ResultStatusFlaky},
+		{Server: "b", Protocol: check.ProtocolHttp1_1, Name: "post_cancel_post.partial_transfer", Status: check.ResultStatusOk},
+	} {
+		m.add(&result)
+	}
+	assert.Equal(t, []*conformanceMatrixRow{
+		{Protocol: check.ProtocolHttp1_1, Name: "get_first", Statuses: map[string]check.ResultStatus{"a": check.ResultStatusOk, "b": check.ResultStatusFlaky}},
+		{Protocol: check.ProtocolHttp1_1, Name: "post_cancel_post.partial_transfer", Statuses: map[string]check.ResultStatus{"a": check.ResultStatusError, "b": check.ResultStatusOk}},
+		{Protocol: check.ProtocolH2c, Name: "get_first", Statuses: map[string]check.ResultStatus{"a": check.ResultStatusSkipped}},
+	}, m.Rows)
+
+	noColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = noColor }()
+	var out bytes.Buffer
+	m.print(&out)
+	assert.Equal(t, ""+
+		"protocol/result                            a        b      \n"+
+		"http1.1/get_first                          ok       flaky  \n"+
+		"http1.1/post_cancel_post.partial_transfer  error    ok     \n"+
+		"h2c/get_first                              skipped  -      \n", out.String())
+}
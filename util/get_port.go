@@ -78,3 +78,9 @@ func (p *PortPool) Release(port string) {
 	}
 	p.reservedPorts = slices.Delete(p.reservedPorts, idx, idx+1)
 }
+
+func (p *PortPool) IsReserved(port string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Contains(p.reservedPorts, port)
+}